@@ -0,0 +1,213 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/smarthome-go/sdk"
+)
+
+// Is returned by `apiRequest` if the server does not provide an endpoint, for instance because it is too old
+var errEndpointNotFound = errors.New("the server does not provide this endpoint")
+
+var (
+	// Stores the session cookie of the CLI's own requests
+	// The SDK does not expose its session, therefore the CLI logs in separately
+	apiJar, _ = cookiejar.New(nil)
+	// Is used for requests to API endpoints which are not (yet) covered by the SDK
+	apiClient = &http.Client{Jar: apiJar, Timeout: 30 * time.Second, Transport: apiTransport}
+	// Guards `apiLoggedIn`
+	apiSessionLock sync.Mutex
+	apiLoggedIn    bool
+	// Is set to 1 once the server turned out not to provide the WebSocket endpoint
+	// Parallel executions dial concurrently, therefore it is accessed atomically
+	streamUnavailable int32
+)
+
+// Returns the URL of an API endpoint
+// Credentials are never part of the URL because URLs end up in the logs of servers and proxies
+func apiURL(path string) url.URL {
+	requestURL := *Connection.SmarthomeURL
+	requestURL.Path = path
+	requestURL.RawQuery = ""
+	return requestURL
+}
+
+// Logs in using the stored credentials so that `apiJar` holds a valid session cookie
+// If `force` is set, a new session is created even if there already is one
+func apiLogin(force bool) error {
+	apiSessionLock.Lock()
+	defer apiSessionLock.Unlock()
+	if apiLoggedIn && !force {
+		return nil
+	}
+	path := "/api/login"
+	var payload interface{} = map[string]string{
+		"username": Config.Credentials.Username,
+		"password": Config.Credentials.Password,
+	}
+	if Config.Connection.UseToken {
+		path = "/api/login/token"
+		payload = map[string]string{"token": Config.Credentials.Token}
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	loginURL := apiURL(path)
+	res, err := apiClient.Post(loginURL.String(), "application/json", bytes.NewReader(body))
+	if err != nil {
+		return apiTransportError(err)
+	}
+	res.Body.Close()
+	switch res.StatusCode {
+	case http.StatusOK, http.StatusNoContent:
+		apiLoggedIn = true
+		return nil
+	case http.StatusUnauthorized:
+		return sdk.ErrInvalidCredentials
+	case http.StatusServiceUnavailable:
+		return sdk.ErrServiceUnavailable
+	}
+	return fmt.Errorf("unexpected response from server during login: %s", res.Status)
+}
+
+// Sends an authenticated request to a Smarthome API endpoint which is not (yet) covered by the SDK
+// Authentication uses a session cookie, an expired session is renewed once
+// The caller is responsible for closing the response body
+func apiRequest(method string, path string, body io.Reader) (*http.Response, error) {
+	// The body is buffered so that the request can be repeated after renewing the session
+	var content []byte
+	if body != nil {
+		var err error
+		if content, err = io.ReadAll(body); err != nil {
+			return nil, err
+		}
+	}
+	if err := apiLogin(false); err != nil {
+		return nil, err
+	}
+	res, err := sendAPIRequest(method, path, content)
+	if err == sdk.ErrInvalidCredentials {
+		if err := apiLogin(true); err != nil {
+			return nil, err
+		}
+		res, err = sendAPIRequest(method, path, content)
+	}
+	return res, err
+}
+
+func sendAPIRequest(method string, path string, content []byte) (*http.Response, error) {
+	requestURL := apiURL(path)
+	var body io.Reader
+	if content != nil {
+		body = bytes.NewReader(content)
+	}
+	req, err := http.NewRequest(method, requestURL.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	if content != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	res, err := apiClient.Do(req)
+	if err != nil {
+		return nil, apiTransportError(err)
+	}
+	switch res.StatusCode {
+	case http.StatusOK:
+		return res, nil
+	case http.StatusUnauthorized:
+		res.Body.Close()
+		return nil, sdk.ErrInvalidCredentials
+	case http.StatusForbidden:
+		res.Body.Close()
+		return nil, sdk.ErrPermissionDenied
+	case http.StatusUnprocessableEntity:
+		res.Body.Close()
+		return nil, sdk.ErrUnprocessableEntity
+	case http.StatusNotFound:
+		res.Body.Close()
+		return nil, errEndpointNotFound
+	case http.StatusServiceUnavailable:
+		res.Body.Close()
+		return nil, sdk.ErrServiceUnavailable
+	default:
+		res.Body.Close()
+		return nil, fmt.Errorf("unexpected response from server: %s", res.Status)
+	}
+}
+
+// Converts an error of the HTTP client into the error reported to the user
+// TLS failures are explained because they usually require changing the configuration, other failures are reported as `sdk.ErrConnFailed`
+func apiTransportError(err error) error {
+	if explanation, ok := explainTLSError(err); ok {
+		return fmt.Errorf("TLS handshake failed: %s", explanation)
+	}
+	return sdk.ErrConnFailed
+}
+
+// Opens a WebSocket connection to the server's Homescript run endpoint
+// Is used as `workspace.StreamDialer`
+func dialHomescriptStream() (*websocket.Conn, error) {
+	if atomic.LoadInt32(&streamUnavailable) == 1 {
+		return nil, websocket.ErrBadHandshake
+	}
+	if err := apiLogin(false); err != nil {
+		return nil, err
+	}
+	conn, res, err := dialAPIWebsocket("/api/homescript/run/ws")
+	if res != nil && res.StatusCode == http.StatusUnauthorized {
+		// The session has expired, renew it and try again
+		if err := apiLogin(true); err != nil {
+			return nil, err
+		}
+		conn, res, err = dialAPIWebsocket("/api/homescript/run/ws")
+	}
+	if err != nil {
+		if Verbose {
+			fmt.Printf("Output streaming is not available, falling back to regular execution: %s\n", describeTLSError(err))
+		}
+		// The server does not provide the endpoint, do not try again during this session
+		if err == websocket.ErrBadHandshake {
+			atomic.StoreInt32(&streamUnavailable, 1)
+		}
+		return nil, err
+	}
+	res.Body.Close()
+	return conn, nil
+}
+
+// Opens a WebSocket connection to an API endpoint which is authenticated using the session cookie
+func dialAPIWebsocket(path string) (*websocket.Conn, *http.Response, error) {
+	sessionURL := apiURL(path)
+	streamURL := sessionURL
+	if streamURL.Scheme == "https" {
+		streamURL.Scheme = "wss"
+	} else {
+		streamURL.Scheme = "ws"
+	}
+	// The cookie is looked up using the HTTP URL because the cookie jar only supports HTTP(S)
+	cookies := make([]string, 0)
+	for _, cookie := range apiJar.Cookies(&sessionURL) {
+		cookies = append(cookies, cookie.String())
+	}
+	header := http.Header{}
+	if len(cookies) > 0 {
+		header.Set("Cookie", strings.Join(cookies, "; "))
+	}
+	dialer := websocket.Dialer{HandshakeTimeout: 5 * time.Second, TLSClientConfig: tlsConfig}
+	return dialer.Dial(streamURL.String(), header)
+}
@@ -10,6 +10,8 @@ import (
 	"github.com/fatih/color"
 	"github.com/pelletier/go-toml"
 	"github.com/rodaine/table"
+
+	"github.com/smarthome-go/cli/cmd/workspace"
 )
 
 // Is appended to the user's configuration directory path
@@ -24,11 +26,22 @@ type Configuration struct {
 	Connection  ConnectionConfig `toml:"connection"`  // Connection settings
 	Credentials Credentials      `toml:"credentials"` // Credential store
 	Homescript  HomescriptConfig `toml:"homescript"`  // Homescript settings
+	Repl        ReplConfig       `toml:"repl"`        // Interactive REPL settings
+	Power       PowerConfig      `toml:"power"`       // Power usage settings
 }
 
 type ConnectionConfig struct {
 	SmarthomeUrl string `toml:"smarthome_url"`        // Connection URL
 	UseToken     bool   `toml:"token_authentication"` // If token or user + password authentication should be used
+	// Path to a PEM file of CA certificates which are trusted in addition to the system's
+	CaBundle string `toml:"tls_ca_bundle"`
+	// Paths to a PEM encoded client certificate and its key for mutual TLS
+	ClientCert string `toml:"tls_client_cert"`
+	ClientKey  string `toml:"tls_client_key"`
+	// Base64 encoded SHA-256 hashes of the server's public key (SPKI), the connection fails if none matches
+	PinSha256 []string `toml:"tls_pin_sha256"`
+	// Disables the verification of the server's certificate, only use this for testing
+	InsecureSkipVerify bool `toml:"tls_insecure_skip_verify"`
 }
 
 type Credentials struct {
@@ -40,6 +53,30 @@ type Credentials struct {
 type HomescriptConfig struct {
 	// Whether to lint Homescript projects before push
 	LintOnPush bool `toml:"lint_on_push"`
+	// Timeout (in seconds) for executing and linting Homescript
+	Timeout int `toml:"timeout"`
+	// Whether output is streamed while Homescript is running (requires server support)
+	// Is a pointer so that configuration files created before this setting existed default to streaming
+	StreamOutput *bool `toml:"stream_output"`
+	// How many lines of code are shown around errors, zero (or a negative value) hides the surrounding code
+	// Is a pointer so that zero can be distinguished from a missing setting, which uses the default
+	ErrorContextLines *int `toml:"error_context_lines"`
+}
+
+type ReplConfig struct {
+	// How many lines are kept in the history file of each server + user combination
+	HistorySize int `toml:"history_size"`
+	// Lines matching any of these regular expressions are never recorded in the history
+	HistoryExclude []string `toml:"history_exclude"`
+	// Interval (in seconds) in which the REPL checks its connection, a negative value disables the keepalive
+	KeepaliveInterval int `toml:"keepalive_interval"`
+}
+
+type PowerConfig struct {
+	// Price of one kWh used for cost estimations, zero disables cost estimations
+	TariffPrice float64 `toml:"tariff_price"`
+	// Currency of the tariff price, for instance `EUR`
+	TariffCurrency string `toml:"tariff_currency"`
 }
 
 func readConfigFile() {
@@ -66,7 +103,19 @@ func readConfigFile() {
 				Password: "",
 			},
 			Homescript: HomescriptConfig{
-				LintOnPush: true,
+				LintOnPush:        true,
+				Timeout:           int(workspace.DefaultTimeout.Seconds()),
+				StreamOutput:      &streamOutputDefault,
+				ErrorContextLines: &workspace.DefaultContextLines,
+			},
+			Repl: ReplConfig{
+				HistorySize:       defaultHistorySize,
+				HistoryExclude:    []string{"password"},
+				KeepaliveInterval: defaultKeepaliveInterval,
+			},
+			Power: PowerConfig{
+				TariffPrice:    0,
+				TariffCurrency: "EUR",
 			},
 		}
 		marshaled, err := toml.Marshal(Config)
@@ -96,6 +145,29 @@ func readConfigFile() {
 		fmt.Printf("Failed to parse configuration file at `%s`: invalid TOML format: %s\n", configFilePath, err.Error())
 		os.Exit(1)
 	}
+	applyConfigOverrides()
+}
+
+// Reads the existing configuration file and applies the overrides from flags
+// Unlike `readConfigFile`, it never creates a file, prints or exits, which is required during shell completion
+func loadConfig() error {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return err
+	}
+	fileContent, err := os.ReadFile(fmt.Sprintf("%s/%s", configDir, filePath))
+	if err != nil {
+		return err
+	}
+	if err := toml.Unmarshal(fileContent, &Config); err != nil {
+		return err
+	}
+	applyConfigOverrides()
+	return nil
+}
+
+// Replaces settings of the configuration file with the ones given via flags
+func applyConfigOverrides() {
 	if overrideConfig.Credentials.Username != "" {
 		if Verbose {
 			fmt.Println("Selected username from flags instead of file.")
@@ -114,6 +186,21 @@ func readConfigFile() {
 		}
 		Config.Connection.SmarthomeUrl = overrideConfig.Connection.SmarthomeUrl
 	}
+	if overrideConfig.Connection.CaBundle != "" {
+		Config.Connection.CaBundle = overrideConfig.Connection.CaBundle
+	}
+	if overrideConfig.Connection.ClientCert != "" {
+		Config.Connection.ClientCert = overrideConfig.Connection.ClientCert
+	}
+	if overrideConfig.Connection.ClientKey != "" {
+		Config.Connection.ClientKey = overrideConfig.Connection.ClientKey
+	}
+	if len(overrideConfig.Connection.PinSha256) > 0 {
+		Config.Connection.PinSha256 = overrideConfig.Connection.PinSha256
+	}
+	if overrideConfig.Connection.InsecureSkipVerify {
+		Config.Connection.InsecureSkipVerify = true
+	}
 	if !overrideConfig.Homescript.LintOnPush {
 		if Verbose {
 			fmt.Println("Selected lint-on-push from flags instead of file.")
@@ -141,6 +228,27 @@ func printConfig() {
 		authMethodString = "authentication token"
 	}
 	tbl.AddRow("Authentication Mode", authMethodString)
+	// TLS settings
+	caBundleStr := "system"
+	if Config.Connection.CaBundle != "" {
+		caBundleStr = fmt.Sprintf("system + %s", Config.Connection.CaBundle)
+	}
+	tbl.AddRow("TLS trusted CAs", caBundleStr)
+	clientCertStr := "none"
+	if Config.Connection.ClientCert != "" {
+		clientCertStr = Config.Connection.ClientCert
+	}
+	tbl.AddRow("TLS client certificate", clientCertStr)
+	pinsStr := "none"
+	if len(Config.Connection.PinSha256) > 0 {
+		pinsStr = strings.Join(Config.Connection.PinSha256, ", ")
+	}
+	tbl.AddRow("TLS pins", pinsStr)
+	verifyStr := "enabled"
+	if Config.Connection.InsecureSkipVerify {
+		verifyStr = "DISABLED"
+	}
+	tbl.AddRow("TLS verification", verifyStr)
 	// Credential display
 	if Config.Connection.UseToken {
 		tbl.AddRow("Token", strings.Repeat("*", utf8.RuneCount([]byte(Config.Credentials.Token))))
@@ -153,6 +261,24 @@ func printConfig() {
 		lintOnPushStr = "no"
 	}
 	tbl.AddRow("Lint HMS on push", lintOnPushStr)
+	tbl.AddRow("HMS timeout", homescriptTimeout().String())
+	streamOutputStr := "yes"
+	if !streamOutput() {
+		streamOutputStr = "no"
+	}
+	tbl.AddRow("Stream HMS output", streamOutputStr)
+	tbl.AddRow("REPL history size", historySize())
+	tbl.AddRow("REPL history exclude", strings.Join(Config.Repl.HistoryExclude, ", "))
+	keepaliveStr := "disabled"
+	if keepaliveInterval() > 0 {
+		keepaliveStr = keepaliveInterval().String()
+	}
+	tbl.AddRow("REPL keepalive", keepaliveStr)
+	tariffStr := "disabled"
+	if Config.Power.TariffPrice > 0 {
+		tariffStr = fmt.Sprintf("%.4f %s/kWh", Config.Power.TariffPrice, Config.Power.TariffCurrency)
+	}
+	tbl.AddRow("Power tariff", tariffStr)
 	tbl.Print()
 }
 
@@ -4,15 +4,113 @@ import (
 	"fmt"
 	"time"
 
-	"github.com/briandowns/spinner"
 	"github.com/fatih/color"
 	"github.com/rodaine/table"
+
+	"github.com/smarthome-go/cli/cmd/progress"
 	"github.com/smarthome-go/sdk"
 )
 
+// A single parameter of the debug information table
+// Numeric values are stored as `int64` so that deltas can be computed
+type debugRow struct {
+	name  string
+	value interface{}
+}
+
 // Prints the server's debugging information
 func printDebugInfo() {
-	s := spinner.New(spinner.CharSets[11], 100*time.Millisecond)
+	debugInfo, ok := fetchDebugInfo()
+	if !ok {
+		return
+	}
+	printDebugTable(debugInfo, nil)
+
+	// Also print the Hardware nodes
+	fmt.Println()
+	printHWnodes(debugInfo)
+}
+
+// Prints the debug information table
+// If a previous sample is given, an additional column shows what changed since then
+func printDebugTable(debugInfo sdk.DebugInfoData, previous *sdk.DebugInfoData) {
+	headerFmt := color.New(color.FgGreen, color.Underline).SprintfFunc()
+
+	var tbl table.Table
+	if previous == nil {
+		tbl = table.New("Parameter", "Value")
+	} else {
+		tbl = table.New("Parameter", "Value", "Change")
+	}
+	tbl.WithHeaderFormatter(headerFmt)
+
+	rows := debugRows(debugInfo)
+	var previousRows []debugRow
+	if previous != nil {
+		previousRows = debugRows(*previous)
+	}
+	for index, row := range rows {
+		if previous == nil {
+			tbl.AddRow(row.name, row.value)
+			continue
+		}
+		tbl.AddRow(row.name, row.value, describeDebugChange(previousRows[index].value, row.value))
+	}
+	tbl.Print()
+}
+
+func debugRows(debugInfo sdk.DebugInfoData) []debugRow {
+	dbStatus := "online"
+	if !debugInfo.DatabaseOnline {
+		dbStatus = "OFFLINE"
+	}
+	return []debugRow{
+		// Smarthome version information
+		{"Server version", debugInfo.ServerVersion},
+		{"Server GO version", debugInfo.GoVersion},
+
+		// Performance statistics
+		{"CPU cores", int64(debugInfo.CpuCores)},
+		{"Used MEM", int64(debugInfo.MemoryUsage)},
+		{"Active Goroutines", int64(debugInfo.Goroutines)},
+
+		// Power statistics
+		{"Power jobs", int64(debugInfo.PowerJobCount)},
+		{"Power jobs (FAILED)", int64(debugInfo.PowerJobWithErrorCount)},
+
+		// Database status
+		{"DB status", dbStatus},
+		{"DB conns (open)", int64(debugInfo.DatabaseStats.OpenConnections)},
+		{"DB conns (used)", int64(debugInfo.DatabaseStats.InUse)},
+		{"DB conns (idle)", int64(debugInfo.DatabaseStats.Idle)},
+
+		// Hardware node information
+		{"HW nodes (total  )", int64(debugInfo.HardwareNodesCount)},
+		{"HW nodes (online )", int64(debugInfo.HardwareNodesOnline)},
+		{"HW nodes (enabled)", int64(debugInfo.HardwareNodesEnabled)},
+		{"HMS jobs", int64(debugInfo.HomescriptJobCount)},
+	}
+}
+
+// Describes how a value changed, numeric values are shown as a delta
+// Returns an empty string if the value did not change
+func describeDebugChange(before interface{}, after interface{}) string {
+	if before == after {
+		return ""
+	}
+	highlight := color.New(color.FgYellow, color.Bold).SprintfFunc()
+	beforeNumber, beforeNumeric := before.(int64)
+	afterNumber, afterNumeric := after.(int64)
+	if beforeNumeric && afterNumeric {
+		return highlight("%+d", afterNumber-beforeNumber)
+	}
+	return highlight("was %v", before)
+}
+
+// Fetches the server's debugging information while showing a progress indicator
+// On failure, a description of the error is printed and false is returned
+func fetchDebugInfo() (sdk.DebugInfoData, bool) {
+	s := progress.New(progress.CharsetDots, 100*time.Millisecond)
 	s.Suffix = " Loading debug information"
 	s.Start()
 
@@ -29,61 +127,24 @@ func printDebugInfo() {
 			s.FinalMSG = fmt.Sprintf("An unexpected error occurred: %s\n", err.Error())
 		}
 		s.Stop()
-		return
+		return sdk.DebugInfoData{}, false
 	}
 	s.Stop()
-
-	// Generate output
-	headerFmt := color.New(color.FgGreen, color.Underline).SprintfFunc()
-	// columnFmt := color.New(color.FgWhite).SprintfFunc()
-
-	tbl := table.New("Parameter", "Value")
-	tbl.WithHeaderFormatter(headerFmt) //.WithFirstColumnFormatter(columnFmt)
-
-	// Smarthome version information
-	tbl.AddRow("Server version", debugInfo.ServerVersion)
-	tbl.AddRow("Server GO version", debugInfo.GoVersion)
-
-	// Performance statistics
-	tbl.AddRow("CPU cores", debugInfo.CpuCores)
-	tbl.AddRow("Used MEM", debugInfo.MemoryUsage)
-	tbl.AddRow("Active Goroutines", debugInfo.Goroutines)
-
-	// Power statistics
-	tbl.AddRow("Power jobs", debugInfo.PowerJobCount)
-	tbl.AddRow("Power jobs (FAILED)", debugInfo.PowerJobWithErrorCount)
-
-	// Database status
-	onlineStr := "online"
-	if !debugInfo.DatabaseOnline {
-		onlineStr = "OFFLINE"
-	}
-	tbl.AddRow("DB status", onlineStr)
-	tbl.AddRow("DB conns (open)", debugInfo.DatabaseStats.OpenConnections)
-	tbl.AddRow("DB conns (used)", debugInfo.DatabaseStats.InUse)
-	tbl.AddRow("DB conns (idle)", debugInfo.DatabaseStats.Idle)
-
-	// Hardware node information
-	tbl.AddRow("HW nodes (total  )", debugInfo.HardwareNodesCount)
-	tbl.AddRow("HW nodes (online )", debugInfo.HardwareNodesOnline)
-	tbl.AddRow("HW nodes (enabled)", debugInfo.HardwareNodesEnabled)
-	tbl.AddRow("HMS jobs", debugInfo.HomescriptJobCount)
-
-	tbl.Print()
-
-	// Also print the Hardware nodes
-	fmt.Println()
-	printHWnodes(debugInfo)
+	return debugInfo, true
 }
 
 func printHWnodes(debugInfo sdk.DebugInfoData) {
+	printNodesTable(debugInfo.HardwareNodes)
+}
+
+func printNodesTable(nodes []sdk.HardwareNode) {
 	headerFmt := color.New(color.FgGreen, color.Underline).SprintfFunc()
 	columnFmt := color.New(color.FgYellow).SprintfFunc()
 
 	tbl := table.New("URL", "Name", "Enabled", "Online")
 	tbl.WithHeaderFormatter(headerFmt).WithFirstColumnFormatter(columnFmt)
 
-	for _, node := range debugInfo.HardwareNodes {
+	for _, node := range nodes {
 		enabledStr := "yes *"
 		if !node.Enabled {
 			enabledStr = "no  ."
@@ -0,0 +1,247 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/rodaine/table"
+	"github.com/spf13/cobra"
+
+	"github.com/smarthome-go/sdk"
+)
+
+// Debug information saved to a file, for example to be attached to an incident report
+type debugSnapshot struct {
+	SavedAt   time.Time         `json:"savedAt"`
+	Server    string            `json:"server"`
+	DebugInfo sdk.DebugInfoData `json:"debugInfo"`
+}
+
+func createCmdDebug() *cobra.Command {
+	var (
+		watchInterval time.Duration
+		savePath      string
+	)
+	cmdDebug := &cobra.Command{
+		Use:   "debug",
+		Short: "Server Debug Info",
+		Long:  "Prints debugging information about the Smarthome server",
+		Args:  cobra.NoArgs,
+		PreRun: func(cmd *cobra.Command, args []string) {
+			readConfigFile()
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			if watchInterval != 0 && savePath != "" {
+				fmt.Println("The flags `--watch` and `--save` are mutually exclusive.")
+				os.Exit(1)
+			}
+			if cmd.Flags().Changed("watch") && watchInterval < time.Second {
+				fmt.Println("The watch interval must be at least one second.")
+				os.Exit(1)
+			}
+			InitConn()
+			switch {
+			case watchInterval != 0:
+				os.Exit(watchDebugInfo(watchInterval))
+			case savePath != "":
+				debugInfo, ok := fetchDebugInfo()
+				if !ok {
+					os.Exit(1)
+				}
+				if err := writeDebugSnapshot(savePath, debugInfo); err != nil {
+					fmt.Printf("Could not save snapshot: %s\n", err.Error())
+					os.Exit(1)
+				}
+				fmt.Printf("Saved debug information to %s\n", savePath)
+			default:
+				printDebugInfo()
+			}
+		},
+	}
+	cmdDebug.Flags().DurationVar(&watchInterval, "watch", 0, "Re-render the debug information in the given interval and highlight changes")
+	cmdDebug.Flags().StringVar(&savePath, "save", "", "Save the debug information as a JSON snapshot to the given file")
+
+	cmdDebugDiff := &cobra.Command{
+		Use:   "diff [before.json] [after.json]",
+		Short: "Compare Debug Snapshots",
+		Long:  "Compares two snapshots created using `debug --save` and prints the values which differ",
+		Args:  cobra.ExactArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			before, err := readDebugSnapshot(args[0])
+			if err != nil {
+				fmt.Printf("Could not read snapshot: %s\n", err.Error())
+				os.Exit(1)
+			}
+			after, err := readDebugSnapshot(args[1])
+			if err != nil {
+				fmt.Printf("Could not read snapshot: %s\n", err.Error())
+				os.Exit(1)
+			}
+			printDebugDiff(before, after)
+		},
+	}
+	cmdDebug.AddCommand(cmdDebugDiff)
+
+	return cmdDebug
+}
+
+// Re-renders the debug information in the given interval until interrupted
+// Returns the exit code
+func watchDebugInfo(interval time.Duration) int {
+	current, ok := fetchDebugInfo()
+	if !ok {
+		return 1
+	}
+	var (
+		previous  *sdk.DebugInfoData
+		lastError error
+	)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		// Clear the screen and move the cursor to the top
+		fmt.Print("\x1b[H\x1b[2J")
+		fmt.Printf("Debug information of %s at %s, refreshing every %s. Press Ctrl+C to stop.\n\n", Connection.SmarthomeURL.Host, time.Now().Format("15:04:05"), interval)
+		printDebugTable(current, previous)
+		fmt.Println()
+		printHWnodes(current)
+		if previous != nil {
+			for _, change := range nodeChanges(previous.HardwareNodes, current.HardwareNodes) {
+				fmt.Println(color.New(color.FgYellow, color.Bold).Sprint(change))
+			}
+		}
+		if lastError != nil {
+			fmt.Printf("\nFailed to refresh debug information: %s\n", lastError.Error())
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return 0
+		}
+		debugInfo, err := Connection.GetDebugInfo()
+		if err == sdk.ErrInvalidCredentials {
+			if err = reconnect(); err == nil {
+				debugInfo, err = Connection.GetDebugInfo()
+			}
+		}
+		// Failures are shown below the last sample, the next refresh might succeed
+		lastError = err
+		if err != nil {
+			continue
+		}
+		sample := current
+		previous = &sample
+		current = debugInfo
+	}
+}
+
+// Describes which hardware nodes were added, removed or changed their state
+func nodeChanges(before []sdk.HardwareNode, after []sdk.HardwareNode) []string {
+	changes := make([]string, 0)
+	previous := make(map[string]sdk.HardwareNode)
+	for _, node := range before {
+		previous[node.Url] = node
+	}
+	for _, node := range after {
+		old, exists := previous[node.Url]
+		if !exists {
+			changes = append(changes, fmt.Sprintf("Node `%s` (%s) was added", node.Name, node.Url))
+			continue
+		}
+		delete(previous, node.Url)
+		if old.Online != node.Online {
+			changes = append(changes, fmt.Sprintf("Node `%s` (%s) is now %s", node.Name, node.Url, onlineLabel(node.Online)))
+		}
+		if old.Enabled != node.Enabled {
+			state := "disabled"
+			if node.Enabled {
+				state = "enabled"
+			}
+			changes = append(changes, fmt.Sprintf("Node `%s` (%s) was %s", node.Name, node.Url, state))
+		}
+	}
+	for _, node := range before {
+		if _, removed := previous[node.Url]; removed {
+			changes = append(changes, fmt.Sprintf("Node `%s` (%s) was removed", node.Name, node.Url))
+		}
+	}
+	return changes
+}
+
+// Prints the values which differ between two snapshots
+func printDebugDiff(before debugSnapshot, after debugSnapshot) {
+	fmt.Printf("Before: %s (%s)\n", before.SavedAt.Local().Format(time.RFC1123), before.Server)
+	fmt.Printf("After:  %s (%s)\n\n", after.SavedAt.Local().Format(time.RFC1123), after.Server)
+
+	headerFmt := color.New(color.FgGreen, color.Underline).SprintfFunc()
+	columnFmt := color.New(color.FgYellow).SprintfFunc()
+
+	tbl := table.New("Parameter", "Before", "After", "Change")
+	tbl.WithHeaderFormatter(headerFmt).WithFirstColumnFormatter(columnFmt)
+	beforeRows := debugRows(before.DebugInfo)
+	changed := 0
+	for index, row := range debugRows(after.DebugInfo) {
+		change := describeDebugChange(beforeRows[index].value, row.value)
+		if change == "" {
+			continue
+		}
+		changed++
+		tbl.AddRow(row.name, beforeRows[index].value, row.value, change)
+	}
+	nodes := nodeChanges(before.DebugInfo.HardwareNodes, after.DebugInfo.HardwareNodes)
+	if changed == 0 && len(nodes) == 0 {
+		fmt.Println("The snapshots do not differ.")
+		return
+	}
+	if changed > 0 {
+		tbl.Print()
+	}
+	if len(nodes) > 0 {
+		if changed > 0 {
+			fmt.Println()
+		}
+		for _, change := range nodes {
+			fmt.Println(change)
+		}
+	}
+}
+
+// Writes a snapshot of the debug information to a file
+// The tokens of the hardware nodes are removed so that snapshots can be shared safely
+func writeDebugSnapshot(path string, debugInfo sdk.DebugInfoData) error {
+	nodes := make([]sdk.HardwareNode, 0, len(debugInfo.HardwareNodes))
+	for _, node := range debugInfo.HardwareNodes {
+		node.Token = ""
+		nodes = append(nodes, node)
+	}
+	debugInfo.HardwareNodes = nodes
+	marshaled, err := json.MarshalIndent(debugSnapshot{
+		SavedAt:   time.Now(),
+		Server:    Connection.SmarthomeURL.String(),
+		DebugInfo: debugInfo,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(marshaled, '\n'), 0644)
+}
+
+func readDebugSnapshot(path string) (debugSnapshot, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return debugSnapshot{}, err
+	}
+	var snapshot debugSnapshot
+	if err := json.Unmarshal(content, &snapshot); err != nil {
+		return debugSnapshot{}, fmt.Errorf("%s is not a valid snapshot: %s", path, err.Error())
+	}
+	return snapshot, nil
+}
@@ -0,0 +1,351 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/semver"
+	"github.com/fatih/color"
+	"github.com/pelletier/go-toml"
+	"github.com/spf13/cobra"
+
+	"github.com/smarthome-go/sdk"
+)
+
+// Certificates expiring within this duration result in a warning
+const certificateExpiryWarning = 14 * 24 * time.Hour
+
+// Result of a single diagnosis, unless everything is fine, a hint explains how to fix the problem
+type doctorFinding struct {
+	Check   string       `json:"check"`
+	Status  healthStatus `json:"status"`
+	Message string       `json:"message"`
+	Hint    string       `json:"hint,omitempty"`
+}
+
+// Permissions which are required by features of the CLI
+var doctorPermissions = []struct {
+	permission string
+	features   string
+}{
+	{"homescript", "`run`, `exec`, `ws`, `pipe` and the REPL"},
+	{"setPower", "`power on|off|toggle`, `power scene apply` and `rooms on|off`"},
+	{"debug", "`debug`, `nodes`, `exporter` and parts of `health`"},
+}
+
+func createCmdDoctor() *cobra.Command {
+	var (
+		output  string
+		timeout time.Duration
+	)
+	cmdDoctor := &cobra.Command{
+		Use:   "doctor",
+		Short: "Diagnose Setup",
+		Long: "Checks the configuration, the connection to the Smarthome server and the permissions of your user.\n" +
+			"Every problem comes with a hint on how to fix it. Exits with code 1 if any check failed.",
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			if output != "text" && output != "json" {
+				fmt.Printf("Invalid output format `%s`: expected `text` or `json`.\n", output)
+				os.Exit(1)
+			}
+			findings := runDoctor(timeout)
+			exitCode := 0
+			for _, finding := range findings {
+				if finding.Status == healthCritical {
+					exitCode = 1
+				}
+			}
+			if output == "json" {
+				printJSON(findings)
+			} else {
+				printDoctorFindings(findings)
+			}
+			os.Exit(exitCode)
+		},
+	}
+	cmdDoctor.Flags().StringVarP(&output, "output", "o", "text", "Output format: `text` or `json`")
+	cmdDoctor.Flags().DurationVar(&timeout, "connect-timeout", 5*time.Second, "Timeout of the network checks")
+	return cmdDoctor
+}
+
+// Performs all checks in order, checks which depend on a failed check are skipped
+func runDoctor(timeout time.Duration) []doctorFinding {
+	findings := make([]doctorFinding, 0)
+	add := func(check string, status healthStatus, hint string, format string, args ...interface{}) {
+		findings = append(findings, doctorFinding{Check: check, Status: status, Message: fmt.Sprintf(format, args...), Hint: hint})
+	}
+
+	// The configuration file is checked before it is read, because `readConfigFile` exits on invalid files
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		add("config", healthCritical, "Set the `HOME` (or `XDG_CONFIG_HOME`) environment variable", "could not determine the configuration directory: %s", err.Error())
+		return findings
+	}
+	configFilePath := fmt.Sprintf("%s/%s", configDir, filePath)
+	if info, err := os.Stat(configFilePath); os.IsNotExist(err) {
+		add("config", healthWarning, fmt.Sprintf("Run `%s config login` to store your connection settings", os.Args[0]), "no configuration file existed, created one with default settings at %s", configFilePath)
+	} else if err != nil {
+		add("config", healthCritical, "Check the permissions of the configuration directory", "could not access %s: %s", configFilePath, err.Error())
+		return findings
+	} else {
+		content, err := os.ReadFile(configFilePath)
+		if err != nil {
+			add("config", healthCritical, fmt.Sprintf("Make the file readable using `chmod 600 %s`", configFilePath), "could not read %s: %s", configFilePath, err.Error())
+			return findings
+		}
+		var parsed Configuration
+		if err := toml.Unmarshal(content, &parsed); err != nil {
+			add("config", healthCritical, "Fix the syntax error or delete the file to recreate the default configuration", "%s is not valid TOML: %s", configFilePath, err.Error())
+			return findings
+		}
+		if err := toml.NewDecoder(bytes.NewReader(content)).Strict(true).Decode(&parsed); err != nil {
+			add("config", healthWarning, "Remove or correct the unknown settings, they are ignored", "%s contains unknown settings: %s", configFilePath, err.Error())
+		} else {
+			add("config", healthOK, "", "%s is valid", configFilePath)
+		}
+		// Windows does not use Unix permissions
+		if runtime.GOOS != "windows" && info.Mode().Perm()&0077 != 0 {
+			add("config-permissions", healthWarning, fmt.Sprintf("Run `chmod 600 %s`", configFilePath), "%s is accessible by other users (mode %04o) although it may contain credentials", configFilePath, info.Mode().Perm())
+		} else {
+			add("config-permissions", healthOK, "", "only accessible by you")
+		}
+	}
+	readConfigFile()
+
+	// TLS settings
+	if err := configureTLS(); err != nil {
+		add("tls-config", healthCritical, "Fix the TLS settings (`tls_ca_bundle`, `tls_client_cert`, `tls_client_key`, `tls_pin_sha256`) of the configuration or the corresponding flags", "invalid TLS settings: %s", err.Error())
+		return findings
+	}
+	if Config.Connection.InsecureSkipVerify && len(Config.Connection.PinSha256) == 0 {
+		add("tls-config", healthWarning, "Trust the server's CA using `tls_ca_bundle` or pin its key using `tls_pin_sha256` instead of disabling verification", "verification of the server's certificate is disabled")
+	}
+
+	// URL scheme
+	urlHint := fmt.Sprintf("Set a URL like `https://smarthome.example.com` using `%s config login` or `--ip`", os.Args[0])
+	if !strings.HasPrefix(Config.Connection.SmarthomeUrl, "https://") && !strings.HasPrefix(Config.Connection.SmarthomeUrl, "http://") {
+		add("url", healthWarning, urlHint, "`%s` has no scheme, plain HTTP is assumed", Config.Connection.SmarthomeUrl)
+		Config.Connection.SmarthomeUrl = "http://" + Config.Connection.SmarthomeUrl
+	}
+	serverURL, err := url.Parse(Config.Connection.SmarthomeUrl)
+	if err != nil || serverURL.Hostname() == "" {
+		add("url", healthCritical, urlHint, "`%s` is not a valid URL", Config.Connection.SmarthomeUrl)
+		return findings
+	}
+	hostname := serverURL.Hostname()
+	ip := net.ParseIP(hostname)
+	switch {
+	case serverURL.Scheme == "https":
+		add("url", healthOK, "", "%s uses HTTPS", serverURL.Host)
+	case hostname == "localhost" || (ip != nil && ip.IsLoopback()):
+		add("url", healthOK, "", "%s uses plain HTTP on the local machine", serverURL.Host)
+	default:
+		add("url", healthWarning, "Serve Smarthome via HTTPS (for instance behind a reverse proxy) and use an `https://` URL", "credentials are sent to %s unencrypted via plain HTTP", serverURL.Host)
+	}
+
+	// Name resolution and reachability
+	if ip != nil {
+		add("dns", healthOK, "", "%s is an IP address", hostname)
+	} else {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		addresses, err := net.DefaultResolver.LookupHost(ctx, hostname)
+		cancel()
+		if err != nil {
+			add("dns", healthCritical, "Check the host name in `smarthome_url` and your DNS settings", "could not resolve %s: %s", hostname, err.Error())
+			return findings
+		}
+		add("dns", healthOK, "", "%s resolves to %s", hostname, strings.Join(addresses, ", "))
+	}
+	port := serverURL.Port()
+	if port == "" {
+		port = "80"
+		if serverURL.Scheme == "https" {
+			port = "443"
+		}
+	}
+	address := net.JoinHostPort(hostname, port)
+	startTime := time.Now()
+	tcpConn, err := net.DialTimeout("tcp", address, timeout)
+	if err != nil {
+		add("tcp", healthCritical, fmt.Sprintf("Check that the server is running and that no firewall blocks port %s", port), "could not connect to %s: %s", address, err.Error())
+		return findings
+	}
+	tcpConn.Close()
+	add("tcp", healthOK, "", "connected to %s in %dms", address, time.Since(startTime).Milliseconds())
+
+	// Certificate
+	if serverURL.Scheme != "https" {
+		add("tls", healthUnknown, "", "skipped: the server is not using HTTPS")
+	} else {
+		config := &tls.Config{}
+		if tlsConfig != nil {
+			config = tlsConfig.Clone()
+		}
+		config.ServerName = hostname
+		tlsConn, err := tls.DialWithDialer(&net.Dialer{Timeout: timeout}, "tcp", address, config)
+		if err != nil {
+			explanation := strings.SplitN(describeTLSError(err), "\n=> ", 2)
+			hint := "Renew the certificate or adjust the TLS settings of the configuration"
+			if len(explanation) == 2 {
+				hint = explanation[1]
+			}
+			add("tls", healthCritical, hint, "the TLS handshake with %s failed: %s", hostname, explanation[0])
+			return findings
+		}
+		certificate := tlsConn.ConnectionState().PeerCertificates[0]
+		tlsConn.Close()
+		remaining := time.Until(certificate.NotAfter)
+		if remaining < certificateExpiryWarning {
+			add("tls", healthWarning, "Renew the certificate of the server", "the certificate expires in %d day(s) (%s)", int(remaining.Hours()/24), certificate.NotAfter.Local().Format(time.RFC1123))
+		} else {
+			add("tls", healthOK, "", "the certificate is valid until %s (issued by %s)", certificate.NotAfter.Local().Format("2006-01-02"), certificate.Issuer.CommonName)
+		}
+	}
+
+	conn, err := sdk.NewConnection(Config.Connection.SmarthomeUrl, authMethod())
+	if err != nil {
+		add("version", healthCritical, "Check that the URL points to a Smarthome server", "could not connect to the server: %s", err.Error())
+		return findings
+	}
+
+	// Authentication, the SDK fetches and validates the server version while logging in
+	loginHint := fmt.Sprintf("Update your credentials using `%s config login`", os.Args[0])
+	if (Config.Connection.UseToken && Config.Credentials.Token == "") || (!Config.Connection.UseToken && Config.Credentials.Username == "") {
+		add("version", healthUnknown, "", "skipped: the version is validated while logging in")
+		add("login", healthCritical, loginHint, "no credentials are configured, you will be prompted for them")
+		return findings
+	}
+	switch err := authenticate(conn); err {
+	case nil:
+		Connection = conn
+		add("version", healthOK, "", "server v%s is supported by this client v%s (requires >= v%s)", conn.SmarthomeVersion, sdk.Version, sdk.MinSmarthomeVersion)
+	case sdk.ErrUnsupportedVersion:
+		serverVersion := conn.SmarthomeVersion
+		if serverVersion == "" {
+			serverVersion = "(unknown)"
+		}
+		add("version", healthCritical, versionHint(serverVersion), "server v%s is not supported by this client v%s (requires >= v%s)", serverVersion, sdk.Version, sdk.MinSmarthomeVersion)
+		return findings
+	case sdk.ErrInvalidCredentials:
+		if Config.Connection.UseToken {
+			loginHint = fmt.Sprintf("Create a new token at %s/profile and store it using `%s config login`", strings.TrimSuffix(Config.Connection.SmarthomeUrl, "/"), os.Args[0])
+		}
+		add("version", healthUnknown, "", "skipped: login failed")
+		add("login", healthCritical, loginHint, "the server rejected your credentials")
+		return findings
+	default:
+		add("version", healthUnknown, "", "skipped: login failed")
+		add("login", healthCritical, "Check the server's logs", "login failed: %s", err.Error())
+		return findings
+	}
+	if Config.Connection.UseToken {
+		if username, err := Connection.GetUsername(); err == nil {
+			Config.Credentials.Username = username
+		}
+	}
+	add("login", healthOK, "", "logged in as `%s`", Config.Credentials.Username)
+
+	// Permissions
+	granted, err := fetchPermissions()
+	for _, required := range doctorPermissions {
+		check := "permission:" + required.permission
+		hint := fmt.Sprintf("Ask an administrator to grant the permission `%s` to `%s`", required.permission, Config.Credentials.Username)
+		var hasPermission bool
+		if err == nil {
+			hasPermission = containsString(granted, required.permission) || containsString(granted, "*")
+		} else {
+			// Older servers do not report permissions, therefore they are probed using harmless requests
+			var probeErr error
+			switch required.permission {
+			case "homescript":
+				_, probeErr = Connection.ListHomescript()
+			case "debug":
+				_, probeErr = Connection.GetDebugInfo()
+			default:
+				add(check, healthUnknown, "", "could not be determined: %s", err.Error())
+				continue
+			}
+			if probeErr != nil && probeErr != sdk.ErrPermissionDenied {
+				add(check, healthUnknown, "", "could not be determined: %s", probeErr.Error())
+				continue
+			}
+			hasPermission = probeErr == nil
+		}
+		if hasPermission {
+			add(check, healthOK, "", "granted, %s can be used", required.features)
+		} else {
+			add(check, healthWarning, hint, "missing, %s cannot be used", required.features)
+		}
+	}
+	return findings
+}
+
+// Returns the permissions of the current user
+// The SDK does not provide this information, therefore the API is used directly
+func fetchPermissions() ([]string, error) {
+	res, err := apiRequest("GET", "/api/user/permissions/personal", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	permissions := make([]string, 0)
+	if err := json.NewDecoder(res.Body).Decode(&permissions); err != nil {
+		return nil, sdk.ErrReadResponseBody
+	}
+	return permissions, nil
+}
+
+// Explains how to resolve an incompatibility between the server and this client
+func versionHint(serverVersion string) string {
+	serverV, err := semver.NewVersion(serverVersion)
+	if err != nil {
+		return "The server reported an invalid version, check that the URL points to a Smarthome server"
+	}
+	supportV, err := semver.NewVersion(sdk.MinSmarthomeVersion)
+	if err != nil {
+		return "This client is broken, try installing the current version of the CLI"
+	}
+	if serverV.Major() > supportV.Major() {
+		return "The server is newer than this client supports, try installing the current version of the CLI"
+	}
+	return fmt.Sprintf("The server is outdated, try updating it to at least v%s", sdk.MinSmarthomeVersion)
+}
+
+func printDoctorFindings(findings []doctorFinding) {
+	problems := 0
+	for _, finding := range findings {
+		var label string
+		switch finding.Status {
+		case healthOK:
+			label = color.GreenString("[  OK  ]")
+		case healthWarning:
+			label = color.YellowString("[ WARN ]")
+			problems++
+		case healthCritical:
+			label = color.RedString("[ FAIL ]")
+			problems++
+		default:
+			label = color.HiBlackString("[ SKIP ]")
+		}
+		fmt.Printf("%s %s: %s\n", label, finding.Check, finding.Message)
+		if finding.Hint != "" {
+			fmt.Printf("         => %s\n", finding.Hint)
+		}
+	}
+	fmt.Println()
+	if problems == 0 {
+		fmt.Println("No problems found.")
+		return
+	}
+	fmt.Printf("%d problem(s) found.\n", problems)
+}
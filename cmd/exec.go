@@ -0,0 +1,211 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/rodaine/table"
+	"github.com/spf13/cobra"
+
+	"github.com/smarthome-go/cli/cmd/progress"
+	"github.com/smarthome-go/cli/cmd/workspace"
+)
+
+// Result of executing a single remote Homescript
+type execResult struct {
+	id       string
+	exitCode int
+	duration time.Duration
+	skipped  bool
+	// Whether the execution was cancelled because another Homescript failed
+	cancelled bool
+}
+
+func createCmdExec() *cobra.Command {
+	var (
+		lint     bool
+		parallel bool
+		policy   string
+	)
+	cmdExec := &cobra.Command{
+		Use:   "exec [hms-id...] [key=value...]",
+		Short: "Run remote Homescripts",
+		Long: "Runs one or more Homescripts stored on the server by their ID without a local project.\n" +
+			"Arguments containing a separator ('=' or ':') are passed to every Homescript.\n" +
+			"The exit code policy decides whether execution stops at the first failure (first-fail) or continues (all).\n" +
+			"first-fail: no further Homescripts are started after a failure (with --parallel, running ones are cancelled), the exit code is the one of the first failure.\n" +
+			"all: every Homescript runs to completion, the exit code is the highest one of all Homescripts.",
+		Args:              cobra.MinimumNArgs(1),
+		ValidArgsFunction: completeHomescriptIds,
+		PreRun: func(cmd *cobra.Command, args []string) {
+			readConfigFile()
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			if policy != "first-fail" && policy != "all" {
+				fmt.Printf("Invalid exit code policy `%s`: expected `first-fail` or `all`.\n", policy)
+				os.Exit(1)
+			}
+			// Separate the Homescript IDs from the arguments
+			ids := make([]string, 0)
+			argTokens := make([]string, 0)
+			for _, arg := range args {
+				if strings.ContainsAny(arg, "=:") {
+					argTokens = append(argTokens, arg)
+				} else {
+					ids = append(ids, arg)
+				}
+			}
+			if len(ids) == 0 {
+				fmt.Println("No Homescript ID specified.")
+				os.Exit(1)
+			}
+			hmsArgs, err := collectHmsArgs(argTokens)
+			if err != nil {
+				fmt.Println(err.Error())
+				os.Exit(1)
+			}
+			InitConn()
+			os.Exit(execHomescripts(ids, hmsArgs, lint, parallel, policy == "first-fail"))
+		},
+	}
+	addHmsArgFlags(cmdExec)
+	cmdExec.Flags().BoolVarP(&lint, "lint", "l", false, "Lint the Homescripts instead of executing them")
+	cmdExec.Flags().BoolVarP(&parallel, "parallel", "P", false, "Execute all Homescripts concurrently")
+	cmdExec.Flags().StringVar(&policy, "policy", "first-fail", "Exit code policy for multiple Homescripts: `first-fail` (stop at and return the first failure) or `all` (run all, return the highest exit code)")
+	return cmdExec
+}
+
+// Executes (or lints) the given Homescripts and returns the combined exit code
+// If `stopOnFailure` is set, the combined exit code is the one of the first failure, otherwise it is the highest exit code
+func execHomescripts(ids []string, args map[string]string, lint bool, parallel bool, stopOnFailure bool) int {
+	// Is cancelled after the first failure if `stopOnFailure` is set
+	group, cancelGroup := context.WithCancel(context.Background())
+	defer cancelGroup()
+
+	run := func(id string) execResult {
+		ctx, cancel := homescriptContext()
+		defer cancel()
+		go func() {
+			select {
+			case <-group.Done():
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+		startTime := time.Now()
+		var exitCode int
+		if lint {
+			exitCode = workspace.LintById(ctx, Connection, id, args)
+		} else {
+			exitCode = workspace.RunById(ctx, Connection, id, args)
+		}
+		// Homescripts which finished successfully before the cancellation are not affected
+		if exitCode != 0 && group.Err() != nil {
+			return execResult{id: id, exitCode: exitCode, duration: time.Since(startTime), cancelled: true}
+		}
+		return execResult{id: id, exitCode: exitCode, duration: time.Since(startTime)}
+	}
+
+	results := make([]execResult, len(ids))
+	// Index of the first failed Homescript in chronological order
+	firstFailure := -1
+	if parallel && len(ids) > 1 {
+		// Concurrent output would be garbled by spinners and streamed output
+		progress.NonInteractive = true
+		workspace.StreamOutput = false
+		var (
+			wg   sync.WaitGroup
+			lock sync.Mutex
+		)
+		for index, id := range ids {
+			wg.Add(1)
+			go func(index int, id string) {
+				defer wg.Done()
+				result := run(id)
+				lock.Lock()
+				defer lock.Unlock()
+				results[index] = result
+				if result.exitCode != 0 && !result.cancelled && firstFailure == -1 {
+					firstFailure = index
+					if stopOnFailure {
+						cancelGroup()
+					}
+				}
+			}(index, id)
+		}
+		wg.Wait()
+	} else {
+		for index, id := range ids {
+			if firstFailure != -1 && stopOnFailure {
+				results[index] = execResult{id: id, skipped: true}
+				continue
+			}
+			if len(ids) > 1 {
+				fmt.Printf("\x1b[1;34m==>\x1b[0m %s\n", id)
+			}
+			results[index] = run(id)
+			if results[index].exitCode != 0 && firstFailure == -1 {
+				firstFailure = index
+			}
+		}
+	}
+
+	exitCode := 0
+	if stopOnFailure {
+		if firstFailure != -1 {
+			exitCode = results[firstFailure].exitCode
+		}
+	} else {
+		for _, result := range results {
+			if !result.skipped && result.exitCode > exitCode {
+				exitCode = result.exitCode
+			}
+		}
+	}
+	if len(ids) == 1 {
+		return exitCode
+	}
+
+	fmt.Println()
+	headerFmt := color.New(color.FgGreen, color.Underline).SprintfFunc()
+	columnFmt := color.New(color.FgYellow).SprintfFunc()
+
+	tbl := table.New("ID", "Exit code", "Duration")
+	tbl.WithHeaderFormatter(headerFmt).WithFirstColumnFormatter(columnFmt)
+	for _, result := range results {
+		if result.skipped {
+			tbl.AddRow(result.id, "skipped", "-")
+			continue
+		}
+		if result.cancelled {
+			tbl.AddRow(result.id, "cancelled", fmt.Sprintf("%.2fs", result.duration.Seconds()))
+			continue
+		}
+		tbl.AddRow(result.id, result.exitCode, fmt.Sprintf("%.2fs", result.duration.Seconds()))
+	}
+	tbl.Print()
+	return exitCode
+}
+
+// Completes Homescript IDs using the server's list of Homescripts
+func completeHomescriptIds(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if err := connectForCompletion(); err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+	scripts, err := Connection.ListHomescript()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+	completions := make([]string, 0, len(scripts))
+	for _, script := range scripts {
+		if strings.HasPrefix(script.Data.Id, toComplete) {
+			completions = append(completions, fmt.Sprintf("%s\t%s", script.Data.Id, script.Data.Name))
+		}
+	}
+	return completions, cobra.ShellCompDirectiveNoFileComp
+}
@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/fatih/color"
+
+	"github.com/smarthome-go/cli/cmd/workspace"
+)
+
+var (
+	// Overrides the configured Homescript timeout if set
+	timeoutFlag time.Duration
+	// Disables output streaming regardless of the configuration
+	noStreamFlag bool
+	// Disables colors in Homescript error messages
+	noColorFlag bool
+)
+
+// Applies the diagnostics settings of the configuration and flags
+func initDiagnostics() {
+	if Config.Homescript.ErrorContextLines != nil {
+		workspace.Diagnostics.ContextLines = *Config.Homescript.ErrorContextLines
+	}
+	if noColorFlag || os.Getenv("NO_COLOR") != "" {
+		workspace.Diagnostics.Color = false
+		color.NoColor = true
+	}
+}
+
+// Enables live output streaming if it is configured and not disabled via flags
+// The WebSocket endpoint is used in any case because it allows terminating executions of arbitrary code
+func initStreaming() {
+	workspace.StreamDialer = dialHomescriptStream
+	workspace.StreamOutput = streamOutput() && !noStreamFlag
+}
+
+// Output is streamed unless `stream_output` is explicitly disabled in the configuration
+var streamOutputDefault = true
+
+func streamOutput() bool {
+	if Config.Homescript.StreamOutput == nil {
+		return streamOutputDefault
+	}
+	return *Config.Homescript.StreamOutput
+}
+
+// Returns the timeout for Homescript executions and lints
+// The `--timeout` flag takes precedence over the configuration file
+func homescriptTimeout() time.Duration {
+	if timeoutFlag > 0 {
+		return timeoutFlag
+	}
+	if Config.Homescript.Timeout > 0 {
+		return time.Duration(Config.Homescript.Timeout) * time.Second
+	}
+	return workspace.DefaultTimeout
+}
+
+// Returns a context for a Homescript execution
+// It is cancelled if the user presses Ctrl+C or if the configured timeout expires
+func homescriptContext() (context.Context, context.CancelFunc) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	ctx, cancel := context.WithTimeout(ctx, homescriptTimeout())
+	return ctx, func() {
+		cancel()
+		stop()
+	}
+}
+
+// Requests termination of a Homescript on the server, which terminates EVERY running job of that Homescript
+// Is used as `workspace.TerminateHook` if the server lacks the WebSocket endpoint, otherwise only the cancelled job is terminated via the stream
+func terminateHomescript(id string) error {
+	if id == "" {
+		// Jobs of arbitrary code can only be addressed through the WebSocket endpoint
+		return errors.New("this server does not support terminating arbitrary code (it lacks the WebSocket endpoint), the code keeps running on the server until it finishes")
+	}
+	if Verbose {
+		fmt.Printf("Requesting termination of `%s` on the server...\n", id)
+	}
+	res, err := apiRequest("POST", fmt.Sprintf("/api/homescript/kill/script/%s", url.PathEscape(id)), nil)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	return nil
+}
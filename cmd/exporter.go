@@ -0,0 +1,223 @@
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/smarthome-go/cli/cmd/progress"
+	"github.com/smarthome-go/sdk"
+)
+
+// Latest state of the server collected by the exporter
+type exporterSnapshot struct {
+	debugInfo    sdk.DebugInfoData
+	debugOK      bool
+	switches     []sdk.Switch
+	switchesOK   bool
+	collectedAt  time.Time
+	duration     time.Duration
+	scrapeErrors int
+}
+
+// Periodically collects metrics and serves them in the Prometheus text format
+type metricsExporter struct {
+	lock     sync.Mutex
+	snapshot exporterSnapshot
+}
+
+func createCmdExporter() *cobra.Command {
+	var (
+		listen   string
+		interval time.Duration
+	)
+	cmdExporter := &cobra.Command{
+		Use:   "exporter",
+		Short: "Prometheus Exporter",
+		Long: "Periodically collects debug information and switch states of the Smarthome server and serves them at `/metrics` in the Prometheus text format.\n" +
+			"Debug metrics require the permission `debug`, switch metrics require the permission to list all switches.",
+		Args: cobra.NoArgs,
+		PreRun: func(cmd *cobra.Command, args []string) {
+			readConfigFile()
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			if interval < time.Second {
+				fmt.Println("The collection interval must be at least one second.")
+				os.Exit(1)
+			}
+			progress.NonInteractive = true
+			InitConn()
+			exporter := &metricsExporter{}
+			exporter.collect()
+			go func() {
+				ticker := time.NewTicker(interval)
+				defer ticker.Stop()
+				for range ticker.C {
+					exporter.collect()
+				}
+			}()
+
+			mux := http.NewServeMux()
+			mux.HandleFunc("/metrics", exporter.serveMetrics)
+			mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/" {
+					http.NotFound(w, r)
+					return
+				}
+				fmt.Fprint(w, "<html><head><title>Smarthome Exporter</title></head><body><h1>Smarthome Exporter</h1><p><a href=\"/metrics\">Metrics</a></p></body></html>\n")
+			})
+			fmt.Printf("Serving metrics of %s at http://%s/metrics (collecting every %s)\n", Connection.SmarthomeURL.Host, listen, interval)
+			if err := http.ListenAndServe(listen, mux); err != nil {
+				fmt.Printf("Could not serve metrics: %s\n", err.Error())
+				os.Exit(1)
+			}
+		},
+	}
+	cmdExporter.Flags().StringVar(&listen, "listen", ":9300", "Address on which metrics are served")
+	cmdExporter.Flags().DurationVar(&interval, "interval", 15*time.Second, "Interval in which metrics are collected from the server")
+	return cmdExporter
+}
+
+// Fetches the current debug information and switches
+// Expired sessions are re-established automatically
+func (e *metricsExporter) collect() {
+	startTime := time.Now()
+	debugInfo, debugErr := Connection.GetDebugInfo()
+	switches, switchesErr := Connection.GetAllSwitches()
+	if debugErr == sdk.ErrInvalidCredentials || switchesErr == sdk.ErrInvalidCredentials {
+		if err := reconnect(); err != nil {
+			fmt.Printf("Could not re-establish session: %s\n", err.Error())
+		} else {
+			debugInfo, debugErr = Connection.GetDebugInfo()
+			switches, switchesErr = Connection.GetAllSwitches()
+		}
+	}
+	if debugErr != nil {
+		fmt.Printf("Failed to collect debug information: %s\n", debugErr.Error())
+	}
+	if switchesErr != nil {
+		fmt.Printf("Failed to collect switches: %s\n", switchesErr.Error())
+	}
+
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if debugErr != nil || switchesErr != nil {
+		e.snapshot.scrapeErrors++
+	}
+	e.snapshot.debugInfo = debugInfo
+	e.snapshot.debugOK = debugErr == nil
+	e.snapshot.switches = switches
+	e.snapshot.switchesOK = switchesErr == nil
+	e.snapshot.collectedAt = time.Now()
+	e.snapshot.duration = time.Since(startTime)
+}
+
+func (e *metricsExporter) serveMetrics(w http.ResponseWriter, r *http.Request) {
+	e.lock.Lock()
+	snapshot := e.snapshot
+	e.lock.Unlock()
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	fmt.Fprint(w, renderMetrics(snapshot))
+}
+
+// Writes metrics in the Prometheus text exposition format
+type metricsWriter struct {
+	builder strings.Builder
+}
+
+// Writes the `HELP` and `TYPE` lines of a metric
+func (m *metricsWriter) describe(name string, kind string, help string) {
+	m.builder.WriteString(fmt.Sprintf("# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind))
+}
+
+// Writes a sample, labels are given as alternating names and values
+func (m *metricsWriter) sample(name string, value float64, labels ...string) {
+	m.builder.WriteString(name)
+	if len(labels) > 0 {
+		pairs := make([]string, 0, len(labels)/2)
+		for index := 0; index+1 < len(labels); index += 2 {
+			pairs = append(pairs, fmt.Sprintf("%s=\"%s\"", labels[index], escapeLabelValue(labels[index+1])))
+		}
+		m.builder.WriteString("{" + strings.Join(pairs, ",") + "}")
+	}
+	m.builder.WriteString(fmt.Sprintf(" %g\n", value))
+}
+
+func (m *metricsWriter) gauge(name string, help string, value float64) {
+	m.describe(name, "gauge", help)
+	m.sample(name, value)
+}
+
+// Escapes backslashes, quotes and line breaks in label values
+func escapeLabelValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+func boolValue(value bool) float64 {
+	if value {
+		return 1
+	}
+	return 0
+}
+
+func renderMetrics(snapshot exporterSnapshot) string {
+	m := metricsWriter{}
+	m.gauge("smarthome_up", "Whether the last collection of all metrics succeeded", boolValue(snapshot.debugOK && snapshot.switchesOK))
+	m.describe("smarthome_collection_errors_total", "counter", "Number of collections which failed at least partially")
+	m.sample("smarthome_collection_errors_total", float64(snapshot.scrapeErrors))
+	m.gauge("smarthome_collection_duration_seconds", "Duration of the last collection", snapshot.duration.Seconds())
+	m.gauge("smarthome_collection_timestamp_seconds", "Unix time of the last collection", float64(snapshot.collectedAt.Unix()))
+
+	if snapshot.debugOK {
+		info := snapshot.debugInfo
+		m.describe("smarthome_server_info", "gauge", "Version information of the server")
+		m.sample("smarthome_server_info", 1, "version", info.ServerVersion, "go_version", info.GoVersion)
+		m.gauge("smarthome_cpu_cores", "Number of CPU cores of the server", float64(info.CpuCores))
+		m.gauge("smarthome_goroutines", "Number of active goroutines of the server", float64(info.Goroutines))
+		m.gauge("smarthome_memory_usage", "Memory usage as reported by the server", float64(info.MemoryUsage))
+		m.gauge("smarthome_power_jobs", "Number of power jobs", float64(info.PowerJobCount))
+		m.gauge("smarthome_power_jobs_failed", "Number of power jobs which failed", float64(info.PowerJobWithErrorCount))
+		m.gauge("smarthome_homescript_jobs", "Number of running Homescript jobs", float64(info.HomescriptJobCount))
+		m.gauge("smarthome_database_online", "Whether the database is online", boolValue(info.DatabaseOnline))
+		m.describe("smarthome_database_connections", "gauge", "Connections of the database pool by state")
+		m.sample("smarthome_database_connections", float64(info.DatabaseStats.OpenConnections), "state", "open")
+		m.sample("smarthome_database_connections", float64(info.DatabaseStats.InUse), "state", "in_use")
+		m.sample("smarthome_database_connections", float64(info.DatabaseStats.Idle), "state", "idle")
+		m.describe("smarthome_hardware_node_online", "gauge", "Whether a hardware node is online")
+		for _, node := range info.HardwareNodes {
+			m.sample("smarthome_hardware_node_online", boolValue(node.Online), "node", node.Name, "url", node.Url)
+		}
+		m.describe("smarthome_hardware_node_enabled", "gauge", "Whether a hardware node is enabled")
+		for _, node := range info.HardwareNodes {
+			m.sample("smarthome_hardware_node_enabled", boolValue(node.Enabled), "node", node.Name, "url", node.Url)
+		}
+	}
+
+	if snapshot.switchesOK {
+		switches := make([]sdk.Switch, len(snapshot.switches))
+		copy(switches, snapshot.switches)
+		sort.Slice(switches, func(i, j int) bool { return switches[i].Id < switches[j].Id })
+		m.describe("smarthome_switch_power_on", "gauge", "Whether a switch is turned on")
+		for _, sw := range switches {
+			m.sample("smarthome_switch_power_on", boolValue(sw.PowerOn), "switch", sw.Id, "name", sw.Name, "room", sw.RoomId)
+		}
+		m.describe("smarthome_switch_watts", "gauge", "Power draw of a switch when it is turned on")
+		for _, sw := range switches {
+			m.sample("smarthome_switch_watts", float64(sw.Watts), "switch", sw.Id, "name", sw.Name, "room", sw.RoomId)
+		}
+		load := 0.0
+		for _, sw := range switches {
+			if sw.PowerOn {
+				load += float64(sw.Watts)
+			}
+		}
+		m.gauge("smarthome_power_load_watts", "Current power draw of all switches which are turned on", load)
+	}
+	return m.builder.String()
+}
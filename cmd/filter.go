@@ -0,0 +1,113 @@
+package cmd
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/smarthome-go/sdk"
+)
+
+// Filters and sorts switches in listings, is configured using flags
+type switchFilter struct {
+	room     string
+	on       bool
+	off      bool
+	name     string
+	minWatts uint16
+	sortBy   string
+	reverse  bool
+	// Whether all switches (instead of only the personal ones) are listed
+	all bool
+
+	nameExpr *regexp.Regexp
+}
+
+// Registers the filter flags on a command
+// The `--all` flag is only added if the command lists personal switches by default
+func (f *switchFilter) addFlags(cmd *cobra.Command, withAll bool) {
+	cmd.Flags().StringVar(&f.room, "room", "", "Only include switches of the given room")
+	cmd.Flags().BoolVar(&f.on, "on", false, "Only include switches which are on")
+	cmd.Flags().BoolVar(&f.off, "off", false, "Only include switches which are off")
+	cmd.Flags().StringVar(&f.name, "name", "", "Only include switches whose name matches the regular expression")
+	cmd.Flags().Uint16Var(&f.minWatts, "min-watts", 0, "Only include switches drawing at least this many watts")
+	cmd.Flags().StringVar(&f.sortBy, "sort", "", "Sort by `id`, `name`, `room`, `watts` or `power`")
+	cmd.Flags().BoolVar(&f.reverse, "reverse", false, "Reverse the sort order")
+	if withAll {
+		cmd.Flags().BoolVar(&f.all, "all", false, "List all switches instead of only yours (requires permission)")
+	}
+	if err := cmd.RegisterFlagCompletionFunc("room", completeRoomFlag); err != nil {
+		panic(err.Error())
+	}
+	if err := cmd.RegisterFlagCompletionFunc("sort", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return []string{"id", "name", "room", "watts", "power"}, cobra.ShellCompDirectiveNoFileComp
+	}); err != nil {
+		panic(err.Error())
+	}
+}
+
+// Validates the flags and compiles the name expression
+func (f *switchFilter) validate() error {
+	if f.on && f.off {
+		return fmt.Errorf("The flags `--on` and `--off` are mutually exclusive.")
+	}
+	switch f.sortBy {
+	case "", "id", "name", "room", "watts", "power":
+	default:
+		return fmt.Errorf("Invalid sort key `%s`: expected `id`, `name`, `room`, `watts` or `power`.", f.sortBy)
+	}
+	if f.name != "" {
+		expr, err := regexp.Compile(f.name)
+		if err != nil {
+			return fmt.Errorf("Invalid name expression `%s`: %s", f.name, err.Error())
+		}
+		f.nameExpr = expr
+	}
+	return nil
+}
+
+// Returns the switches matching the filter in the requested order
+// Without a sort key, the server's order is kept
+func (f *switchFilter) apply(switches []sdk.Switch) []sdk.Switch {
+	result := make([]sdk.Switch, 0, len(switches))
+	for _, sw := range switches {
+		if f.room != "" && sw.RoomId != f.room {
+			continue
+		}
+		if (f.on && !sw.PowerOn) || (f.off && sw.PowerOn) {
+			continue
+		}
+		if f.nameExpr != nil && !f.nameExpr.MatchString(sw.Name) {
+			continue
+		}
+		if sw.Watts < f.minWatts {
+			continue
+		}
+		result = append(result, sw)
+	}
+	if f.sortBy != "" {
+		sort.SliceStable(result, func(i, j int) bool {
+			a, b := result[i], result[j]
+			switch f.sortBy {
+			case "name":
+				return strings.ToLower(a.Name) < strings.ToLower(b.Name)
+			case "room":
+				return a.RoomId < b.RoomId
+			case "watts":
+				return a.Watts < b.Watts
+			case "power":
+				return !a.PowerOn && b.PowerOn
+			}
+			return a.Id < b.Id
+		})
+	}
+	if f.reverse {
+		for i, j := 0, len(result)-1; i < j; i, j = i+1, j-1 {
+			result[i], result[j] = result[j], result[i]
+		}
+	}
+	return result
+}
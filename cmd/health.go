@@ -0,0 +1,372 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/smarthome-go/sdk"
+)
+
+// Status of a health check, the values are the exit codes used by Nagios / Icinga plugins
+type healthStatus int
+
+const (
+	healthOK healthStatus = iota
+	healthWarning
+	healthCritical
+	healthUnknown
+)
+
+func (s healthStatus) String() string {
+	switch s {
+	case healthOK:
+		return "OK"
+	case healthWarning:
+		return "WARNING"
+	case healthCritical:
+		return "CRITICAL"
+	}
+	return "UNKNOWN"
+}
+
+// Returns how severe a status is when combining several results
+// The numeric values follow the plugin exit codes, in which UNKNOWN (3) would outrank CRITICAL (2)
+func (s healthStatus) severity() int {
+	switch s {
+	case healthOK:
+		return 0
+	case healthWarning:
+		return 1
+	case healthUnknown:
+		return 2
+	}
+	return 3
+}
+
+func (s healthStatus) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+// Names of all available checks in the order in which they are performed
+var healthChecks = []string{"reachable", "login", "version", "database", "db-connections", "nodes", "power-jobs"}
+
+// Result of a single health check
+type healthResult struct {
+	Name    string       `json:"name"`
+	Status  healthStatus `json:"status"`
+	Message string       `json:"message"`
+}
+
+// A performance data value in the Nagios format (`label=value;warn;crit;min`)
+type healthPerfData struct {
+	Label    string `json:"label"`
+	Value    int64  `json:"value"`
+	Warning  int64  `json:"warning,omitempty"`
+	Critical int64  `json:"critical,omitempty"`
+}
+
+// Report which is printed using `--output json`
+type healthReport struct {
+	Status   healthStatus     `json:"status"`
+	ExitCode int              `json:"exitCode"`
+	Checks   []healthResult   `json:"checks"`
+	PerfData []healthPerfData `json:"perfData"`
+}
+
+// Thresholds of the health checks
+type healthThresholds struct {
+	dbInUseWarning      int64
+	dbInUseCritical     int64
+	failedJobsWarning   int64
+	failedJobsCritical  int64
+	reachabilityTimeout time.Duration
+}
+
+func createCmdHealth() *cobra.Command {
+	var (
+		checks     []string
+		output     string
+		thresholds healthThresholds
+	)
+	cmdHealth := &cobra.Command{
+		Use:   "health",
+		Short: "Server Health Check",
+		Long: "Checks the health of the Smarthome server and reports the result like a Nagios / Icinga plugin.\n" +
+			"Exit codes: 0 (OK), 1 (WARNING), 2 (CRITICAL), 3 (UNKNOWN).\n" +
+			fmt.Sprintf("Available checks: %s", strings.Join(healthChecks, ", ")),
+		Args: cobra.NoArgs,
+		PreRun: func(cmd *cobra.Command, args []string) {
+			readConfigFile()
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			if output != "text" && output != "json" {
+				fmt.Printf("UNKNOWN - invalid output format `%s`: expected `text` or `json`\n", output)
+				os.Exit(int(healthUnknown))
+			}
+			for _, check := range checks {
+				if !containsString(healthChecks, check) {
+					fmt.Printf("UNKNOWN - invalid check `%s`: expected one of %s\n", check, strings.Join(healthChecks, ", "))
+					os.Exit(int(healthUnknown))
+				}
+			}
+			report := runHealthChecks(checks, thresholds)
+			if output == "json" {
+				printJSON(report)
+			} else {
+				printHealthReport(report)
+			}
+			os.Exit(report.ExitCode)
+		},
+	}
+	cmdHealth.Flags().StringSliceVar(&checks, "checks", healthChecks, "Checks to perform (comma-separated)")
+	cmdHealth.Flags().StringVarP(&output, "output", "o", "text", "Output format: `text` (Nagios plugin format) or `json`")
+	cmdHealth.Flags().Int64Var(&thresholds.dbInUseWarning, "db-warn", 20, "Database connections in use which result in a warning")
+	cmdHealth.Flags().Int64Var(&thresholds.dbInUseCritical, "db-crit", 40, "Database connections in use which are critical")
+	cmdHealth.Flags().Int64Var(&thresholds.failedJobsWarning, "failed-jobs-warn", 1, "Failed power jobs which result in a warning")
+	cmdHealth.Flags().Int64Var(&thresholds.failedJobsCritical, "failed-jobs-crit", 5, "Failed power jobs which are critical")
+	cmdHealth.Flags().DurationVar(&thresholds.reachabilityTimeout, "connect-timeout", 5*time.Second, "Timeout of the reachability check")
+	return cmdHealth
+}
+
+// Performs the selected checks
+// Checks which depend on a failed check are reported as unknown
+func runHealthChecks(checks []string, thresholds healthThresholds) healthReport {
+	selected := make(map[string]bool, len(checks))
+	for _, check := range checks {
+		selected[check] = true
+	}
+	report := healthReport{
+		Checks:   make([]healthResult, 0),
+		PerfData: make([]healthPerfData, 0),
+	}
+	add := func(name string, status healthStatus, format string, args ...interface{}) {
+		if selected[name] {
+			report.Checks = append(report.Checks, healthResult{Name: name, Status: status, Message: fmt.Sprintf(format, args...)})
+		}
+	}
+	// Performance data is only reported for the selected checks
+	addPerfData := func(name string, data healthPerfData) {
+		if selected[name] {
+			report.PerfData = append(report.PerfData, data)
+		}
+	}
+
+	if !strings.HasPrefix(Config.Connection.SmarthomeUrl, "https://") && !strings.HasPrefix(Config.Connection.SmarthomeUrl, "http://") {
+		Config.Connection.SmarthomeUrl = "http://" + Config.Connection.SmarthomeUrl
+	}
+
+	tlsErr := configureTLS()
+
+	// The server is reachable if it responds without a server error
+	if tlsErr != nil {
+		add("reachable", healthCritical, "invalid TLS settings: %s", tlsErr.Error())
+	} else if selected["reachable"] {
+		client := http.Client{Timeout: thresholds.reachabilityTimeout, Transport: apiTransport}
+		startTime := time.Now()
+		res, err := client.Get(strings.TrimSuffix(Config.Connection.SmarthomeUrl, "/") + "/health")
+		if err != nil {
+			add("reachable", healthCritical, "could not reach %s: %s", Config.Connection.SmarthomeUrl, err.Error())
+		} else {
+			res.Body.Close()
+			latency := time.Since(startTime)
+			if res.StatusCode >= 500 {
+				add("reachable", healthCritical, "server responded with `%s` in %dms", res.Status, latency.Milliseconds())
+			} else {
+				add("reachable", healthOK, "server responded with `%s` in %dms", res.Status, latency.Milliseconds())
+			}
+			addPerfData("reachable", healthPerfData{Label: "response_time_ms", Value: latency.Milliseconds()})
+		}
+	}
+
+	// Logging in also validates the server's version
+	var (
+		conn     *sdk.Connection
+		loginErr error
+	)
+	if (Config.Connection.UseToken && Config.Credentials.Token == "") || (!Config.Connection.UseToken && Config.Credentials.Username == "") {
+		loginErr = sdk.ErrInvalidCredentials
+		add("login", healthUnknown, "no credentials are configured")
+	} else if tlsErr != nil {
+		loginErr = tlsErr
+		add("login", healthUnknown, "skipped: invalid TLS settings")
+	} else {
+		conn, loginErr = sdk.NewConnection(Config.Connection.SmarthomeUrl, authMethod())
+		if loginErr == nil {
+			loginErr = authenticate(conn)
+		}
+		switch loginErr {
+		case nil:
+			Connection = conn
+			add("login", healthOK, "logged in as `%s`", Config.Credentials.Username)
+		case sdk.ErrUnsupportedVersion:
+			add("login", healthUnknown, "skipped: the server version is not supported")
+		case sdk.ErrInvalidCredentials:
+			add("login", healthCritical, "invalid credentials")
+		case sdk.ErrConnFailed:
+			if handshakeErr := checkTLSHandshake(thresholds.reachabilityTimeout); handshakeErr != nil {
+				add("login", healthCritical, "TLS handshake failed: %s", handshakeErr.Error())
+			} else {
+				add("login", healthCritical, "network connection to Smarthome failed")
+			}
+		case sdk.ErrServiceUnavailable:
+			add("login", healthCritical, "Smarthome is currently unavailable")
+		default:
+			add("login", healthCritical, "login failed: %s", loginErr.Error())
+		}
+	}
+	switch loginErr {
+	case nil:
+		add("version", healthOK, "server v%s is supported (requires >= v%s)", conn.SmarthomeVersion, sdk.MinSmarthomeVersion)
+	case sdk.ErrUnsupportedVersion:
+		serverVersion := "(unknown)"
+		if conn != nil {
+			serverVersion = conn.SmarthomeVersion
+		}
+		add("version", healthCritical, "server v%s is not supported (requires >= v%s)", serverVersion, sdk.MinSmarthomeVersion)
+	default:
+		add("version", healthUnknown, "skipped: login failed")
+	}
+
+	debugChecks := selected["database"] || selected["db-connections"] || selected["nodes"] || selected["power-jobs"]
+	if debugChecks {
+		var (
+			debugInfo sdk.DebugInfoData
+			skipped   string
+		)
+		if loginErr != nil {
+			skipped = "skipped: login failed"
+		} else {
+			var err error
+			debugInfo, err = Connection.GetDebugInfo()
+			if err == sdk.ErrPermissionDenied {
+				skipped = "the permission `debug` is required for this check"
+			} else if err != nil {
+				skipped = fmt.Sprintf("could not fetch debug information: %s", err.Error())
+			}
+		}
+		if skipped != "" {
+			for _, name := range []string{"database", "db-connections", "nodes", "power-jobs"} {
+				add(name, healthUnknown, "%s", skipped)
+			}
+		} else {
+			checkDebugInfo(debugInfo, thresholds, add, addPerfData)
+		}
+	}
+
+	report.Status = healthOK
+	for _, result := range report.Checks {
+		if result.Status.severity() > report.Status.severity() {
+			report.Status = result.Status
+		}
+	}
+	report.ExitCode = int(report.Status)
+	return report
+}
+
+// Evaluates the checks which are based on the server's debug information
+func checkDebugInfo(debugInfo sdk.DebugInfoData, thresholds healthThresholds, add func(name string, status healthStatus, format string, args ...interface{}), addPerfData func(name string, data healthPerfData)) {
+	if debugInfo.DatabaseOnline {
+		add("database", healthOK, "database is online")
+	} else {
+		add("database", healthCritical, "database is offline")
+	}
+
+	inUse := int64(debugInfo.DatabaseStats.InUse)
+	dbStatus := healthOK
+	if inUse >= thresholds.dbInUseCritical {
+		dbStatus = healthCritical
+	} else if inUse >= thresholds.dbInUseWarning {
+		dbStatus = healthWarning
+	}
+	add("db-connections", dbStatus, "%d of %d open connections in use", inUse, debugInfo.DatabaseStats.OpenConnections)
+	addPerfData("db-connections", healthPerfData{
+		Label:    "db_in_use",
+		Value:    inUse,
+		Warning:  thresholds.dbInUseWarning,
+		Critical: thresholds.dbInUseCritical,
+	})
+
+	offline := make([]string, 0)
+	enabled := 0
+	for _, node := range debugInfo.HardwareNodes {
+		if !node.Enabled {
+			continue
+		}
+		enabled++
+		if !node.Online {
+			offline = append(offline, node.Name)
+		}
+	}
+	switch {
+	case enabled == 0:
+		add("nodes", healthOK, "no hardware nodes are enabled")
+	case len(offline) == 0:
+		add("nodes", healthOK, "all %d enabled hardware nodes are online", enabled)
+	case len(offline) == enabled:
+		add("nodes", healthCritical, "all %d enabled hardware nodes are offline", enabled)
+	default:
+		add("nodes", healthWarning, "%d of %d enabled hardware nodes are offline: %s", len(offline), enabled, strings.Join(offline, ", "))
+	}
+	addPerfData("nodes", healthPerfData{Label: "nodes_offline", Value: int64(len(offline))})
+
+	failedJobs := int64(debugInfo.PowerJobWithErrorCount)
+	jobsStatus := healthOK
+	if failedJobs >= thresholds.failedJobsCritical {
+		jobsStatus = healthCritical
+	} else if failedJobs >= thresholds.failedJobsWarning {
+		jobsStatus = healthWarning
+	}
+	add("power-jobs", jobsStatus, "%d of %d power jobs failed", failedJobs, debugInfo.PowerJobCount)
+	addPerfData("power-jobs", healthPerfData{
+		Label:    "failed_power_jobs",
+		Value:    failedJobs,
+		Warning:  thresholds.failedJobsWarning,
+		Critical: thresholds.failedJobsCritical,
+	})
+}
+
+// Prints the report in the Nagios plugin format
+// The first line contains the overall status and performance data, the following lines describe every check
+func printHealthReport(report healthReport) {
+	problems := make([]string, 0)
+	for _, result := range report.Checks {
+		if result.Status != healthOK {
+			problems = append(problems, fmt.Sprintf("%s: %s", result.Name, result.Message))
+		}
+	}
+	summary := fmt.Sprintf("all %d checks passed", len(report.Checks))
+	if len(problems) > 0 {
+		summary = strings.Join(problems, "; ")
+	}
+	perfData := make([]string, 0, len(report.PerfData))
+	for _, data := range report.PerfData {
+		if data.Warning != 0 || data.Critical != 0 {
+			perfData = append(perfData, fmt.Sprintf("%s=%d;%d;%d;0", data.Label, data.Value, data.Warning, data.Critical))
+		} else {
+			perfData = append(perfData, fmt.Sprintf("%s=%d", data.Label, data.Value))
+		}
+	}
+	fmt.Printf("SMARTHOME %s - %s", report.Status, summary)
+	if len(perfData) > 0 {
+		fmt.Printf(" | %s", strings.Join(perfData, " "))
+	}
+	fmt.Println()
+	for _, result := range report.Checks {
+		fmt.Printf("[%s] %s: %s\n", result.Status, result.Name, result.Message)
+	}
+}
+
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
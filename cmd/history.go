@@ -0,0 +1,192 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/chzyer/readline"
+)
+
+// Is used if the configuration file does not specify a history size
+const defaultHistorySize = 500
+
+var (
+	// Lines which were entered during the current REPL session (excluding CLI commands)
+	sessionHistory []string
+	// Compiled `history_exclude` patterns from the configuration
+	historyExcludes []*regexp.Regexp
+	// Matches every character which should not be part of a filename
+	unsafeFilenameChars = regexp.MustCompile(`[^a-zA-Z0-9._-]`)
+)
+
+// Returns the configured history size or the default if it is not set
+func historySize() int {
+	if Config.Repl.HistorySize <= 0 {
+		return defaultHistorySize
+	}
+	return Config.Repl.HistorySize
+}
+
+// Replaces every character which could cause trouble in a filename
+func sanitizeFilename(name string) string {
+	return unsafeFilenameChars.ReplaceAllString(name, "_")
+}
+
+// Returns the path of the history file for the current server and user
+// Every server + user combination uses its own file so that histories are never mixed up
+func historyFilePath(username string) string {
+	historyDir := "/tmp"
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		fmt.Println("Failed to setup default history, user has no default caching directory, using fallback at `/tmp`")
+	} else {
+		historyDir = fmt.Sprintf("%s/%s/history", cacheDir, filePathPrefix)
+		if err := os.MkdirAll(historyDir, 0700); err != nil {
+			fmt.Printf("Failed to create history directory, using fallback at `/tmp`: %s\n", err.Error())
+			historyDir = "/tmp"
+		}
+	}
+	return fmt.Sprintf(
+		"%s/%s@%s.history",
+		historyDir,
+		sanitizeFilename(username),
+		sanitizeFilename(Connection.SmarthomeURL.Host),
+	)
+}
+
+// Compiles the exclusion patterns from the configuration
+// Invalid patterns are reported and skipped
+func initHistoryExcludes() {
+	historyExcludes = make([]*regexp.Regexp, 0)
+	for _, pattern := range Config.Repl.HistoryExclude {
+		expr, err := regexp.Compile(pattern)
+		if err != nil {
+			fmt.Printf("Warning: ignoring invalid history exclusion pattern `%s`: %s\n", pattern, err.Error())
+			continue
+		}
+		historyExcludes = append(historyExcludes, expr)
+	}
+}
+
+// Loads the existing history file into `History`
+func loadHistory(historyFile string) {
+	History = make([]string, 0)
+	file, err := os.Open(historyFile)
+	if err != nil {
+		if !os.IsNotExist(err) && Verbose {
+			fmt.Printf("Could not load history: %s\n", err.Error())
+		}
+		return
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if line := scanner.Text(); line != "" {
+			History = append(History, line)
+		}
+	}
+	if len(History) > historySize() {
+		History = History[len(History)-historySize():]
+	}
+}
+
+// Saves a line to the history unless it is empty or matches an exclusion pattern
+func recordHistory(l *readline.Instance, line string) {
+	if strings.TrimSpace(line) == "" {
+		return
+	}
+	for _, expr := range historyExcludes {
+		if expr.MatchString(line) {
+			if Verbose {
+				fmt.Printf("Line was not recorded in history: matches exclusion pattern `%s`\n", expr.String())
+			}
+			return
+		}
+	}
+	if err := l.SaveHistory(line); err != nil {
+		fmt.Printf("Could not save history: %s\n", err.Error())
+	}
+	History = append(History, line)
+	if len(History) > historySize() {
+		History = History[len(History)-historySize():]
+	}
+	if !strings.HasPrefix(strings.TrimSpace(line), "#") {
+		sessionHistory = append(sessionHistory, line)
+	}
+}
+
+// Implements the `#history` REPL command
+//
+//	#history               -> prints the entire history
+//	#history <n>           -> prints the last n entries
+//	#history grep <regex>  -> prints all entries matching the expression
+//	#history export <file> -> writes the current session to a Homescript file
+func historyCommand(args []string) {
+	if len(args) == 0 {
+		printHistory(History, 0)
+		return
+	}
+	switch args[0] {
+	case "grep":
+		if len(args) != 2 {
+			fmt.Println("Usage: #history grep <pattern>")
+			return
+		}
+		expr, err := regexp.Compile(args[1])
+		if err != nil {
+			fmt.Printf("Invalid pattern: %s\n", err.Error())
+			return
+		}
+		matches := 0
+		for index, line := range History {
+			if expr.MatchString(line) {
+				printHistory(History[index:index+1], index)
+				matches++
+			}
+		}
+		if matches == 0 {
+			fmt.Println("No matching history entries.")
+		}
+	case "export":
+		if len(args) != 2 {
+			fmt.Println("Usage: #history export <file.hms>")
+			return
+		}
+		exportHistory(args[1])
+	default:
+		count, err := strconv.Atoi(args[0])
+		if err != nil || count < 0 {
+			fmt.Println("Usage: #history [n | grep <pattern> | export <file.hms>]")
+			return
+		}
+		if count > len(History) {
+			count = len(History)
+		}
+		printHistory(History[len(History)-count:], len(History)-count)
+	}
+}
+
+// Prints history entries with their (1-based) index
+func printHistory(lines []string, offset int) {
+	for index, line := range lines {
+		fmt.Printf(" \x1b[90m%4d\x1b[0m  %s\n", offset+index+1, line)
+	}
+}
+
+// Writes the Homescript code of the current session into a file
+func exportHistory(path string) {
+	if len(sessionHistory) == 0 {
+		fmt.Println("Nothing to export: no code has been entered during this session.")
+		return
+	}
+	content := strings.Join(sessionHistory, "\n") + "\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		fmt.Printf("Failed to export session: %s\n", err.Error())
+		return
+	}
+	fmt.Printf("Exported %d line(s) of this session to `%s`.\n", len(sessionHistory), path)
+}
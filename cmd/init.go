@@ -7,13 +7,14 @@ import (
 	"time"
 
 	"github.com/Masterminds/semver"
-	"github.com/briandowns/spinner"
 	"github.com/howeyc/gopass"
+
+	"github.com/smarthome-go/cli/cmd/progress"
 	"github.com/smarthome-go/sdk"
 )
 
 func InitConn() {
-	s := spinner.New(spinner.CharSets[59], 150*time.Millisecond)
+	s := progress.New(progress.CharsetArrows, 150*time.Millisecond)
 	s.Prefix = "Connecting to Smarthome "
 	PromptLogin(false)
 	s.Start()
@@ -24,40 +25,28 @@ func InitConn() {
 		fmt.Println("Warning: no URL scheme specified: using insecure HTTP")
 		Config.Connection.SmarthomeUrl = "http://" + Config.Connection.SmarthomeUrl
 	}
-	var conn *sdk.Connection
-	var err error
-	if Config.Connection.UseToken {
-		conn, err = sdk.NewConnection(
-			Config.Connection.SmarthomeUrl,
-			sdk.AuthMethodCookieToken,
-		)
-	} else {
-		conn, err = sdk.NewConnection(
-			Config.Connection.SmarthomeUrl,
-			sdk.AuthMethodCookiePassword,
-		)
+	if err := configureTLS(); err != nil {
+		s.FinalMSG = fmt.Sprintf("Invalid TLS settings: %s\n", err.Error())
+		s.Stop()
+		os.Exit(99)
+	}
+	if Config.Connection.InsecureSkipVerify && len(Config.Connection.PinSha256) == 0 {
+		fmt.Println("Warning: verification of the server's certificate is disabled\n=> Is this intended?")
 	}
+	conn, err := sdk.NewConnection(
+		Config.Connection.SmarthomeUrl,
+		authMethod(),
+	)
 	if err != nil {
-		s.FinalMSG = fmt.Sprintf("Could not prepare connection via SDK for Smarthome-server (url: '%s'). Error: %s", Config.Connection.SmarthomeUrl, err.Error())
+		s.FinalMSG = fmt.Sprintf("Could not prepare connection via SDK for Smarthome-server (url: '%s'). Error: %s\n", Config.Connection.SmarthomeUrl, err.Error())
+		if message := tlsFailureMessage(); message != "" {
+			s.FinalMSG = message
+		}
 		s.Stop()
 		os.Exit(99)
 	}
 	Connection = conn
-	if Config.Connection.UseToken {
-		if Verbose {
-			fmt.Println("Note: Using token authentication")
-		}
-		err = Connection.TokenLogin(Config.Credentials.Token)
-	} else {
-		if Verbose {
-			fmt.Println("Note: Using token password")
-		}
-		err = Connection.UserLogin(
-			Config.Credentials.Username,
-			Config.Credentials.Password,
-		)
-	}
-	if err != nil {
+	if err := authenticate(Connection); err != nil {
 		if err == sdk.ErrUnsupportedVersion {
 			// The Server is not compatible with the current client
 			s.FinalMSG = fmt.Sprintf("Could not establish connection to unsupported server.\nThis client (v%s) requires minimal server version '%s' but is using '%s'.\n", sdk.Version, sdk.MinSmarthomeVersion, Connection.SmarthomeVersion)
@@ -82,6 +71,11 @@ func InitConn() {
 			}
 		} else {
 			s.FinalMSG = fmt.Sprintf("Could not initialize SDK for Smarthome-server (url: '%s').\n  Error: %s\n=> You can revise your local configuration using \x1b[32m'%s config'\x1b[0m\n", Config.Connection.SmarthomeUrl, err.Error(), os.Args[0])
+			if err == sdk.ErrConnFailed {
+				if message := tlsFailureMessage(); message != "" {
+					s.FinalMSG = message
+				}
+			}
 		}
 		s.Stop()
 		os.Exit(99)
@@ -97,12 +91,79 @@ func InitConn() {
 			fmt.Println("Successfully fetched username after token authentication")
 		}
 	}
+	initStreaming()
+	initDiagnostics()
 	if Verbose {
 		s.FinalMSG = fmt.Sprintf("Successfully connected to '%s' on port %s\n", Connection.SmarthomeURL.Hostname(), Connection.SmarthomeURL.Port())
 	}
 	s.Stop()
 }
 
+// Explains why the TLS handshake with the server fails, returns an empty string if it succeeds
+// The SDK only reports a failed connection, therefore the handshake is repeated to obtain the cause
+func tlsFailureMessage() string {
+	err := checkTLSHandshake(5 * time.Second)
+	if err == nil {
+		return ""
+	}
+	return fmt.Sprintf("Could not establish a secure connection to Smarthome-server (url: '%s').\n  TLS error: %s\n", Config.Connection.SmarthomeUrl, describeTLSError(err))
+}
+
+// Returns the SDK authentication method matching the configuration
+func authMethod() sdk.AuthMethod {
+	if Config.Connection.UseToken {
+		return sdk.AuthMethodCookieToken
+	}
+	return sdk.AuthMethodCookiePassword
+}
+
+// Logs in using the credentials of the configuration
+func authenticate(conn *sdk.Connection) error {
+	if Config.Connection.UseToken {
+		if Verbose {
+			fmt.Println("Note: Using token authentication")
+		}
+		return conn.TokenLogin(Config.Credentials.Token)
+	}
+	if Verbose {
+		fmt.Println("Note: Using token password")
+	}
+	return conn.UserLogin(
+		Config.Credentials.Username,
+		Config.Credentials.Password,
+	)
+}
+
+// Establishes a new connection using the stored credentials without prompting the user
+// Unlike `InitConn`, errors are returned instead of terminating the program
+func reconnect() error {
+	if err := configureTLS(); err != nil {
+		return err
+	}
+	conn, err := sdk.NewConnection(
+		Config.Connection.SmarthomeUrl,
+		authMethod(),
+	)
+	if err != nil {
+		return err
+	}
+	if err := authenticate(conn); err != nil {
+		return err
+	}
+	Connection = conn
+	return nil
+}
+
+// Connects using the stored configuration for shell completion
+// Completion output must not be corrupted, therefore nothing is printed, the user is never prompted and errors are returned
+func connectForCompletion() error {
+	Verbose = false
+	if err := loadConfig(); err != nil {
+		return err
+	}
+	return reconnect()
+}
+
 // The login function prompts the user to enter their credentials, only used if credentials are not specified beforehand (using config or flags)
 func PromptLogin(force bool) {
 	if force || (Config.Connection.UseToken && Config.Credentials.Token == "") || (!Config.Connection.UseToken && Config.Credentials.Username == "") {
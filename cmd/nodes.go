@@ -0,0 +1,348 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/rodaine/table"
+	"github.com/spf13/cobra"
+
+	"github.com/smarthome-go/sdk"
+)
+
+// JSON representation of a hardware node, the node's token is omitted on purpose
+type nodeJSON struct {
+	Name    string `json:"name"`
+	Url     string `json:"url"`
+	Enabled bool   `json:"enabled"`
+	Online  bool   `json:"online"`
+}
+
+func createCmdNodes() *cobra.Command {
+	cmdNodes := &cobra.Command{
+		Use:   "nodes",
+		Short: "Hardware Nodes Subcommand",
+		Long:  "Hardware nodes subcommand for inspecting and monitoring the server's hardware nodes (requires the permission `debug`)",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := cmd.Help(); err != nil {
+				panic(err.Error())
+			}
+		},
+	}
+
+	var (
+		listOutput  string
+		listOffline bool
+	)
+	cmdNodesList := &cobra.Command{
+		Use:   "ls",
+		Short: "List Hardware Nodes",
+		Long:  "Lists all hardware nodes including their state",
+		Args:  cobra.NoArgs,
+		PreRun: func(cmd *cobra.Command, args []string) {
+			readConfigFile()
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			validateOutputFormat(listOutput)
+			InitConn()
+			nodes := fetchNodes()
+			if listOffline {
+				offline := make([]sdk.HardwareNode, 0)
+				for _, node := range nodes {
+					if !node.Online {
+						offline = append(offline, node)
+					}
+				}
+				nodes = offline
+			}
+			if listOutput == "json" {
+				printJSON(nodesToJSON(nodes))
+				return
+			}
+			if len(nodes) == 0 {
+				if listOffline {
+					fmt.Println("All hardware nodes are online.")
+				} else {
+					fmt.Println("There are no hardware nodes.")
+				}
+				return
+			}
+			printNodesTable(nodes)
+		},
+	}
+	cmdNodesList.Flags().StringVarP(&listOutput, "output", "o", "table", "Output format: `table` or `json`")
+	cmdNodesList.Flags().BoolVar(&listOffline, "offline", false, "Only list nodes which are offline")
+
+	var showOutput string
+	cmdNodesShow := &cobra.Command{
+		Use:               "show [url|name]",
+		Short:             "Show Hardware Node",
+		Long:              "Shows a single hardware node, which is referenced by its URL or by its name",
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: completeNodes,
+		PreRun: func(cmd *cobra.Command, args []string) {
+			readConfigFile()
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			validateOutputFormat(showOutput)
+			InitConn()
+			node, err := resolveNode(fetchNodes(), args[0])
+			if err != nil {
+				fmt.Println(err.Error())
+				os.Exit(1)
+			}
+			if showOutput == "json" {
+				printJSON(nodesToJSON([]sdk.HardwareNode{node})[0])
+				return
+			}
+			headerFmt := color.New(color.FgGreen, color.Underline).SprintfFunc()
+			columnFmt := color.New(color.FgYellow).SprintfFunc()
+
+			tbl := table.New("Parameter", "Value")
+			tbl.WithHeaderFormatter(headerFmt).WithFirstColumnFormatter(columnFmt)
+			tbl.AddRow("Name", node.Name)
+			tbl.AddRow("URL", node.Url)
+			tbl.AddRow("Enabled", yesNo(node.Enabled))
+			tbl.AddRow("Online", yesNo(node.Online))
+			tbl.Print()
+		},
+	}
+	cmdNodesShow.Flags().StringVarP(&showOutput, "output", "o", "table", "Output format: `table` or `json`")
+
+	var (
+		watchInterval     time.Duration
+		watchBell         bool
+		watchExec         string
+		watchExitOnChange bool
+	)
+	cmdNodesWatch := &cobra.Command{
+		Use:   "watch",
+		Short: "Watch Hardware Nodes",
+		Long: "Polls the hardware nodes and reports whenever a node goes offline or comes back online.\n" +
+			"The command given to `--exec` is run on every change with the environment variables `NODE_NAME`, `NODE_URL` and `NODE_ONLINE` set, which can be used for desktop notifications.\n" +
+			"Using `--exit-on-change`, the command exits with code 2 on the first change.",
+		Args: cobra.NoArgs,
+		PreRun: func(cmd *cobra.Command, args []string) {
+			readConfigFile()
+			InitConn()
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			if watchInterval < time.Second {
+				fmt.Println("The polling interval must be at least one second.")
+				os.Exit(1)
+			}
+			os.Exit(watchNodes(watchInterval, watchBell, watchExec, watchExitOnChange))
+		},
+	}
+	cmdNodesWatch.Flags().DurationVar(&watchInterval, "interval", 5*time.Second, "Interval in which the nodes are polled")
+	cmdNodesWatch.Flags().BoolVar(&watchBell, "bell", false, "Ring the terminal bell when a node changes its state")
+	cmdNodesWatch.Flags().StringVar(&watchExec, "exec", "", "Command to run when a node changes its state")
+	cmdNodesWatch.Flags().BoolVar(&watchExitOnChange, "exit-on-change", false, "Exit with code 2 when a node changes its state")
+
+	cmdNodes.AddCommand(cmdNodesList)
+	cmdNodes.AddCommand(cmdNodesShow)
+	cmdNodes.AddCommand(cmdNodesWatch)
+
+	return cmdNodes
+}
+
+// Returns the server's hardware nodes or exits if they cannot be fetched
+func fetchNodes() []sdk.HardwareNode {
+	debugInfo, ok := fetchDebugInfo()
+	if !ok {
+		os.Exit(1)
+	}
+	return debugInfo.HardwareNodes
+}
+
+// Resolves a node by its URL first and by its name second
+func resolveNode(nodes []sdk.HardwareNode, reference string) (sdk.HardwareNode, error) {
+	for _, node := range nodes {
+		if node.Url == reference {
+			return node, nil
+		}
+	}
+	matches := make([]sdk.HardwareNode, 0)
+	for _, node := range nodes {
+		if node.Name == reference {
+			matches = append(matches, node)
+		}
+	}
+	switch len(matches) {
+	case 1:
+		return matches[0], nil
+	case 0:
+		message := fmt.Sprintf("No hardware node matches `%s`.", reference)
+		candidates := make([]string, 0)
+		for _, node := range nodes {
+			if strings.Contains(strings.ToLower(node.Url), strings.ToLower(reference)) ||
+				levenshtein(strings.ToLower(reference), strings.ToLower(node.Name)) <= len(reference)/2+1 {
+				candidates = append(candidates, node.Url)
+			}
+		}
+		if len(candidates) > 0 {
+			message += fmt.Sprintf("\nDid you mean: %s?", strings.Join(candidates, ", "))
+		}
+		return sdk.HardwareNode{}, errors.New(message)
+	default:
+		urls := make([]string, 0, len(matches))
+		for _, node := range matches {
+			urls = append(urls, node.Url)
+		}
+		return sdk.HardwareNode{}, fmt.Errorf("The name `%s` is ambiguous, please use one of the URLs: %s", reference, strings.Join(urls, ", "))
+	}
+}
+
+// Polls the hardware nodes until interrupted and reports changes of their online state
+// Returns the exit code
+func watchNodes(interval time.Duration, bell bool, hook string, exitOnChange bool) int {
+	nodes := fetchNodes()
+	online := 0
+	for _, node := range nodes {
+		if node.Online {
+			online++
+		}
+	}
+	fmt.Printf("Watching %d hardware node(s), %d online. Press Ctrl+C to stop.\n", len(nodes), online)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return 130
+		}
+		debugInfo, err := Connection.GetDebugInfo()
+		if err != nil {
+			switch err {
+			case sdk.ErrConnFailed, sdk.ErrServiceUnavailable:
+				// Temporary failures are tolerated, the next poll might succeed
+				if Verbose {
+					fmt.Printf("Failed to poll hardware nodes: %s\n", err.Error())
+				}
+				continue
+			case sdk.ErrInvalidCredentials:
+				if err := reconnect(); err != nil {
+					fmt.Printf("Could not re-establish session: %s\n", err.Error())
+					return 1
+				}
+				continue
+			}
+			fmt.Printf("Failed to poll hardware nodes: %s\n", err.Error())
+			return 1
+		}
+
+		previous := make(map[string]sdk.HardwareNode)
+		for _, node := range nodes {
+			previous[node.Url] = node
+		}
+		changed := false
+		for _, node := range debugInfo.HardwareNodes {
+			old, exists := previous[node.Url]
+			delete(previous, node.Url)
+			if !exists {
+				fmt.Printf("[%s] Node `%s` (%s) was added, it is %s.\n", time.Now().Format("15:04:05"), node.Name, node.Url, onlineLabel(node.Online))
+				continue
+			}
+			if old.Online == node.Online {
+				continue
+			}
+			changed = true
+			fmt.Printf("[%s] Node `%s` (%s) is now %s.\n", time.Now().Format("15:04:05"), node.Name, node.Url, onlineLabel(node.Online))
+			if bell {
+				fmt.Print("\a")
+			}
+			if hook != "" {
+				runNodeHook(hook, node)
+			}
+		}
+		for _, node := range previous {
+			fmt.Printf("[%s] Node `%s` (%s) was removed.\n", time.Now().Format("15:04:05"), node.Name, node.Url)
+		}
+		nodes = debugInfo.HardwareNodes
+		if changed && exitOnChange {
+			return 2
+		}
+	}
+}
+
+// Runs the user's hook command for a node which changed its state
+// Failures of the hook are reported but do not stop watching
+func runNodeHook(hook string, node sdk.HardwareNode) {
+	var hookCmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		hookCmd = exec.Command("cmd", "/C", hook)
+	} else {
+		hookCmd = exec.Command("sh", "-c", hook)
+	}
+	hookCmd.Env = append(os.Environ(),
+		"NODE_NAME="+node.Name,
+		"NODE_URL="+node.Url,
+		fmt.Sprintf("NODE_ONLINE=%t", node.Online),
+	)
+	hookCmd.Stdout = os.Stdout
+	hookCmd.Stderr = os.Stderr
+	if err := hookCmd.Run(); err != nil {
+		fmt.Printf("Hook command failed: %s\n", err.Error())
+	}
+}
+
+func onlineLabel(online bool) string {
+	if online {
+		return "online"
+	}
+	return "OFFLINE"
+}
+
+func yesNo(value bool) string {
+	if value {
+		return "yes"
+	}
+	return "no"
+}
+
+func nodesToJSON(nodes []sdk.HardwareNode) []nodeJSON {
+	result := make([]nodeJSON, 0, len(nodes))
+	for _, node := range nodes {
+		result = append(result, nodeJSON{
+			Name:    node.Name,
+			Url:     node.Url,
+			Enabled: node.Enabled,
+			Online:  node.Online,
+		})
+	}
+	return result
+}
+
+// Completes hardware node URLs as the first argument of a command
+func completeNodes(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	if err := connectForCompletion(); err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+	debugInfo, err := Connection.GetDebugInfo()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+	completions := make([]string, 0)
+	for _, node := range debugInfo.HardwareNodes {
+		if strings.HasPrefix(node.Url, toComplete) {
+			completions = append(completions, fmt.Sprintf("%s\t%s", node.Url, node.Name))
+		}
+	}
+	return completions, cobra.ShellCompDirectiveNoFileComp
+}
@@ -3,8 +3,14 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"sync"
+	"time"
 
+	"github.com/fatih/color"
+	"github.com/rodaine/table"
 	"github.com/spf13/cobra"
+
+	"github.com/smarthome-go/sdk"
 )
 
 func createCmdPower() *cobra.Command {
@@ -21,107 +27,216 @@ func createCmdPower() *cobra.Command {
 		},
 	}
 
-	// Power on
-	cmdPowerOn := &cobra.Command{
-		Use:   "on [switch-id] ",
-		Short: "Activate Switch",
-		Long:  "Activate an arbitrary switch",
-		Args:  cobra.ExactArgs(1),
+	cmdPowerOn := createCmdPowerAction(
+		"on",
+		"Activate Switches",
+		"Activate one or more switches",
+		func(sw sdk.Switch) bool { return true },
+	)
+	cmdPowerOff := createCmdPowerAction(
+		"off",
+		"Deactivate Switches",
+		"Deactivate one or more switches",
+		func(sw sdk.Switch) bool { return false },
+	)
+	cmdPowerToggle := createCmdPowerAction(
+		"toggle",
+		"Toggle Switch Power",
+		"Toggle the power-state of one or more switches",
+		func(sw sdk.Switch) bool { return !sw.PowerOn },
+	)
+
+	var drawFilter switchFilter
+	cmdPowerSummary := &cobra.Command{
+		Use:   "draw",
+		Short: "Power Draw & States",
+		Long:  "A compact overview of estimated power usage and states, totals only include the switches matching the filters",
+		Args:  cobra.NoArgs,
 		PreRun: func(cmd *cobra.Command, args []string) {
 			readConfigFile()
-			// Initialize Smarthome connection
-			InitConn()
 		},
 		Run: func(cmd *cobra.Command, args []string) {
-			if err := Connection.SetPower(args[0], true); err != nil {
-				fmt.Printf("Could not activate switch.\nError: %s\n", err.Error())
+			if err := drawFilter.validate(); err != nil {
+				fmt.Println(err.Error())
 				os.Exit(1)
 			}
-			fmt.Printf("Successfully turned switch %s on.\n", args[0])
-			os.Exit(0)
+			InitConn()
+			powerStats(drawFilter)
 		},
 	}
+	drawFilter.addFlags(cmdPowerSummary, false)
+
+	cmdPower.AddCommand(cmdPowerOn)
+	cmdPower.AddCommand(cmdPowerOff)
+	cmdPower.AddCommand(cmdPowerToggle)
+	cmdPower.AddCommand(cmdPowerSummary)
+	cmdPower.AddCommand(createCmdPowerWait())
+	cmdPower.AddCommand(createCmdPowerWatch())
+	cmdPower.AddCommand(createCmdPowerHistory())
+	cmdPower.AddCommand(createCmdScene())
+
+	return cmdPower
+}
 
-	// Power off
-	cmdPowerOff := &cobra.Command{
-		Use:   "off [switch-id] ",
-		Short: "Deactivate Switch",
-		Long:  "Deactivate an arbitrary switch",
-		Args:  cobra.ExactArgs(1),
+// Creates a command which changes the power state of the selected switches
+// `target` returns the desired power state of a switch given its current state
+func createCmdPowerAction(action string, short string, long string, target func(sw sdk.Switch) bool) *cobra.Command {
+	var (
+		room     string
+		all      bool
+		dryRun   bool
+		after    time.Duration
+		duration time.Duration
+		detach   bool
+	)
+	cmd := &cobra.Command{
+		Use:   fmt.Sprintf("%s [switch-id|pattern...]", action),
+		Short: short,
+		Long: long + ".\n" +
+			"Switches can be selected by ID, by glob patterns matching IDs or names (for instance `kitchen_*`), by room or all at once.",
 		PreRun: func(cmd *cobra.Command, args []string) {
 			readConfigFile()
-			// Initialize Smarthome connection
-			InitConn()
 		},
 		Run: func(cmd *cobra.Command, args []string) {
-			if err := Connection.SetPower(args[0], false); err != nil {
-				fmt.Printf("Could not deactivate switch.\nError: %s\n", err.Error())
+			if detach && after == 0 && duration == 0 {
+				fmt.Println("The flag `--detach` requires `--after` or `--for`.")
+				os.Exit(1)
+			}
+			if room != "" && all {
+				fmt.Println("The flags `--room` and `--all` are mutually exclusive.")
+				os.Exit(1)
+			}
+			if len(args) == 0 && room == "" && !all {
+				fmt.Println("No switches selected: specify switch IDs, patterns, `--room` or `--all`.")
 				os.Exit(1)
 			}
-			fmt.Printf("Successfully turned switch %s off.\n", args[0])
-			os.Exit(0)
-		},
-	}
-
-	// Power toggle
-	cmdPowerToggle := &cobra.Command{
-		Use:   "toggle [switch-id] ",
-		Short: "Toggle Switch Power",
-		Long:  "Toggle the power-state of an arbitrary switch",
-		Args:  cobra.ExactArgs(1),
-		PreRun: func(cmd *cobra.Command, args []string) {
-			readConfigFile()
 			// Initialize Smarthome connection
 			InitConn()
-		},
-		Run: func(cmd *cobra.Command, args []string) {
-			// Get current power state
 			if Verbose {
-				fmt.Println("Retrieving personal switches in order to get current power state...")
+				fmt.Println("Retrieving personal switches in order to get current power states...")
 			}
-			switches, err := Connection.GetPersonalSwitches()
+			selected, err := selectSwitches(fetchPersonalSwitches(), args, room, all)
 			if err != nil {
-				fmt.Printf("Could not toggle switch: Failed to retrieve current power state.\nError: %s\n", err.Error())
+				fmt.Println(err.Error())
 				os.Exit(1)
 			}
-			currentPower := false
-			for _, sw := range switches {
-				if sw.Id == args[0] {
-					currentPower = sw.PowerOn
-				}
-			}
-			if Verbose {
-				fmt.Println("Current power state has been retrieved successfully")
-			}
-
-			// Change the power state of the switch
-			if err := Connection.SetPower(args[0], !currentPower); err != nil {
-				fmt.Printf("Could not toggle switch.\nError: %s\n", err.Error())
-				os.Exit(1)
+			if dryRun || (after == 0 && duration == 0) {
+				exitCode, _ := runPowerChanges(action, powerChanges(selected, target), dryRun)
+				os.Exit(exitCode)
 			}
-			fmt.Printf("Successfully toggled switch %s.\n", args[0])
-			os.Exit(0)
+			os.Exit(runTimedPowerChanges(action, selected, target, after, duration, detach))
 		},
 	}
+	cmd.Flags().StringVar(&room, "room", "", "Select all switches of the given room")
+	if err := cmd.RegisterFlagCompletionFunc("room", completeRoomFlag); err != nil {
+		panic(err.Error())
+	}
+	cmd.Flags().BoolVar(&all, "all", false, "Select all of your switches")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Only show what would be changed")
+	cmd.Flags().DurationVar(&after, "after", 0, "Wait for the given duration before changing the switches (e.g. `5m`)")
+	cmd.Flags().DurationVar(&duration, "for", 0, "Restore the previous power states after the given duration (e.g. `20m`)")
+	cmd.Flags().BoolVar(&detach, "detach", false, "Let a one-shot Homescript on the server perform delayed changes instead of waiting in the foreground")
+	return cmd
+}
 
-	cmdPowerSummary := &cobra.Command{
-		Use:   "draw",
-		Short: "Power Draw & States",
-		Long:  "A compact overview of estimated power usage and states",
-		Args:  cobra.NoArgs,
-		PreRun: func(cmd *cobra.Command, args []string) {
-			readConfigFile()
-		},
-		Run: func(cmd *cobra.Command, args []string) {
-			InitConn()
-			powerStats()
-		},
+// Applies (or previews) power changes and returns the exit code and the changes which were applied successfully
+// Switches which are already in the desired state are left untouched
+func runPowerChanges(action string, changes []powerChange, dryRun bool) (int, []powerChange) {
+	pending := make([]powerChange, 0, len(changes))
+	for _, change := range changes {
+		if change.sw.PowerOn != change.powerOn {
+			pending = append(pending, change)
+		}
 	}
+	if dryRun {
+		if len(pending) == 0 {
+			fmt.Println("Dry run: no switches would be changed.")
+			return 0, nil
+		}
+		headerFmt := color.New(color.FgGreen, color.Underline).SprintfFunc()
+		columnFmt := color.New(color.FgYellow).SprintfFunc()
 
-	cmdPower.AddCommand(cmdPowerOn)
-	cmdPower.AddCommand(cmdPowerOff)
-	cmdPower.AddCommand(cmdPowerToggle)
-	cmdPower.AddCommand(cmdPowerSummary)
+		tbl := table.New("ID", "Name", "Change")
+		tbl.WithHeaderFormatter(headerFmt).WithFirstColumnFormatter(columnFmt)
+		for _, change := range pending {
+			tbl.AddRow(change.sw.Id, change.sw.Name, fmt.Sprintf("%s -> %s", powerLabel(change.sw.PowerOn), powerLabel(change.powerOn)))
+		}
+		tbl.Print()
+		fmt.Printf("Dry run: %d of %d switch(es) would be changed.\n", len(pending), len(changes))
+		return 0, nil
+	}
+	if len(pending) == 0 {
+		fmt.Println("All selected switches are already in the desired state.")
+		return 0, nil
+	}
+	errs := applyPowerChanges(pending)
+	applied := make([]powerChange, 0, len(pending))
+	for index, change := range pending {
+		if errs[index] == nil {
+			applied = append(applied, change)
+		}
+	}
+	if len(changes) == 1 {
+		if errs[0] != nil {
+			fmt.Printf("Could not %s switch %s.\nError: %s\n", action, pending[0].sw.Id, describePowerError(errs[0]))
+			return 1, applied
+		}
+		fmt.Printf("Successfully turned switch %s %s.\n", pending[0].sw.Id, powerLabel(pending[0].powerOn))
+		return 0, applied
+	}
+	if failed := printPowerResults(pending, errs); failed > 0 {
+		fmt.Printf("%d of %d change(s) failed.\n", failed, len(pending))
+		return 1, applied
+	}
+	return 0, applied
+}
 
-	return cmdPower
+// A requested change of a switch's power state
+type powerChange struct {
+	sw      sdk.Switch
+	powerOn bool
+}
+
+// Sets the power state of all switches concurrently
+// The returned errors are in the order of the changes, a nil error means success
+func applyPowerChanges(changes []powerChange) []error {
+	errs := make([]error, len(changes))
+	var wg sync.WaitGroup
+	for index, change := range changes {
+		wg.Add(1)
+		go func(index int, change powerChange) {
+			defer wg.Done()
+			errs[index] = Connection.SetPower(change.sw.Id, change.powerOn)
+		}(index, change)
+	}
+	wg.Wait()
+	return errs
+}
+
+// Prints the result of every change and returns the number of failed changes
+func printPowerResults(changes []powerChange, errs []error) int {
+	headerFmt := color.New(color.FgGreen, color.Underline).SprintfFunc()
+	columnFmt := color.New(color.FgYellow).SprintfFunc()
+
+	tbl := table.New("ID", "Name", "Change", "Result")
+	tbl.WithHeaderFormatter(headerFmt).WithFirstColumnFormatter(columnFmt)
+	failed := 0
+	for index, change := range changes {
+		result := color.GreenString("ok")
+		if errs[index] != nil {
+			result = color.RedString("failed: %s", describePowerError(errs[index]))
+			failed++
+		}
+		tbl.AddRow(change.sw.Id, change.sw.Name, fmt.Sprintf("%s -> %s", powerLabel(change.sw.PowerOn), powerLabel(change.powerOn)), result)
+	}
+	tbl.Print()
+	return failed
+}
+
+// Returns `on` or `off`
+func powerLabel(powerOn bool) string {
+	if powerOn {
+		return "on"
+	}
+	return "off"
 }
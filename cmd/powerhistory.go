@@ -0,0 +1,567 @@
+package cmd
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/rodaine/table"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+
+	"github.com/smarthome-go/cli/cmd/progress"
+	"github.com/smarthome-go/sdk"
+)
+
+// Local samples which are further apart are treated as a gap (`power watch` was not running)
+const maxLocalSampleGap = 10 * time.Minute
+
+// Interval in which `power watch` records local samples (state changes are recorded immediately)
+const localSampleInterval = time.Minute
+
+// How long local samples are kept, older ones are removed by `power watch`
+const localSampleRetention = 31 * 24 * time.Hour
+
+// Interval in which `power watch` removes expired local samples
+const localSamplePruneInterval = 24 * time.Hour
+
+// Height (in lines) of the power usage chart
+const powerChartHeight = 8
+
+// A recorded power usage datapoint
+type powerSample struct {
+	Time        time.Time `json:"time"`
+	WattsOn     int       `json:"wattsOn"`
+	WattsOff    int       `json:"wattsOff"`
+	SwitchesOn  int       `json:"switchesOn"`
+	SwitchesOff int       `json:"switchesOff"`
+}
+
+// Energy consumption during a period
+type energyPeriod struct {
+	Start time.Time `json:"start"`
+	Kwh   float64   `json:"kwh"`
+}
+
+// Report which is printed using `--output json`
+type powerHistoryReport struct {
+	Source  string         `json:"source"`
+	Since   time.Time      `json:"since"`
+	Samples []powerSample  `json:"samples"`
+	Periods []energyPeriod `json:"periods"`
+	Kwh     float64        `json:"kwh"`
+}
+
+// Power usage datapoint as returned by the server
+type powerDrawPoint struct {
+	Id   uint          `json:"id"`
+	Time int64         `json:"time"` // Unix timestamp in milliseconds
+	On   powerDrawData `json:"on"`
+	Off  powerDrawData `json:"off"`
+}
+
+type powerDrawData struct {
+	SwitchCount uint    `json:"switchCount"`
+	Watts       uint    `json:"watts"`
+	Percent     float64 `json:"percent"`
+}
+
+func createCmdPowerHistory() *cobra.Command {
+	var (
+		since  time.Duration
+		source string
+		group  string
+		output string
+	)
+	cmdPowerHistory := &cobra.Command{
+		Use:   "history",
+		Short: "Power Usage History",
+		Long: "Shows the recorded power usage as a chart including the consumed energy per hour or day.\n" +
+			"If the server does not record power usage, samples recorded locally by `power watch` are used instead.",
+		Args: cobra.NoArgs,
+		PreRun: func(cmd *cobra.Command, args []string) {
+			readConfigFile()
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			if source != "auto" && source != "server" && source != "local" {
+				fmt.Printf("Invalid source `%s`: expected `auto`, `server` or `local`.\n", source)
+				os.Exit(1)
+			}
+			if group != "auto" && group != "hour" && group != "day" {
+				fmt.Printf("Invalid grouping `%s`: expected `auto`, `hour` or `day`.\n", group)
+				os.Exit(1)
+			}
+			if output != "table" && output != "csv" && output != "json" {
+				fmt.Printf("Invalid output format `%s`: expected `table`, `csv` or `json`.\n", output)
+				os.Exit(1)
+			}
+			if since <= 0 {
+				fmt.Println("The duration of `--since` must be positive.")
+				os.Exit(1)
+			}
+			if output != "table" {
+				progress.NonInteractive = true
+			}
+			InitConn()
+			start := time.Now().Add(-since)
+
+			samples, usedSource, err := loadPowerSamples(source, start)
+			if err != nil {
+				fmt.Println(err.Error())
+				os.Exit(1)
+			}
+			if group == "auto" {
+				group = "hour"
+				if since > 48*time.Hour {
+					group = "day"
+				}
+			}
+			maxGap := time.Duration(0)
+			if usedSource == "local" {
+				maxGap = maxLocalSampleGap
+			}
+			periods := energyPerPeriod(samples, group, maxGap)
+			totalKwh := 0.0
+			for _, period := range periods {
+				totalKwh += period.Kwh
+			}
+
+			switch output {
+			case "json":
+				encoder := json.NewEncoder(os.Stdout)
+				encoder.SetIndent("", "  ")
+				if err := encoder.Encode(powerHistoryReport{
+					Source:  usedSource,
+					Since:   start,
+					Samples: samples,
+					Periods: periods,
+					Kwh:     totalKwh,
+				}); err != nil {
+					fmt.Fprintf(os.Stderr, "Could not encode report: %s\n", err.Error())
+					os.Exit(1)
+				}
+			case "csv":
+				if err := writePowerSamplesCSV(os.Stdout, samples); err != nil {
+					fmt.Fprintf(os.Stderr, "Could not write CSV: %s\n", err.Error())
+					os.Exit(1)
+				}
+			default:
+				if len(samples) == 0 {
+					fmt.Printf("No power usage was recorded since %s.\n", start.Format("2006-01-02 15:04"))
+					if usedSource == "local" {
+						fmt.Println("Samples are recorded locally while `power watch` is running.")
+					}
+					return
+				}
+				fmt.Printf("Power usage since %s \x1b[90m(source: %s, %d samples)\x1b[0m\n\n", start.Format("2006-01-02 15:04"), usedSource, len(samples))
+				width, _, err := term.GetSize(int(os.Stdout.Fd()))
+				if err != nil || width > 120 {
+					width = 80
+				}
+				fmt.Print(renderPowerChart(samples, start, time.Now(), width, maxGap))
+				fmt.Println()
+				printEnergyPeriods(periods, group, totalKwh)
+			}
+		},
+	}
+	cmdPowerHistory.Flags().DurationVar(&since, "since", 24*time.Hour, "Show the power usage of this period (e.g. `24h`), local samples are kept for 31 days")
+	cmdPowerHistory.Flags().StringVar(&source, "source", "auto", "Where to read the history from: `auto`, `server` or `local`")
+	cmdPowerHistory.Flags().StringVar(&group, "group", "auto", "Summarize energy per `hour` or `day` (auto selects based on the period)")
+	cmdPowerHistory.Flags().StringVarP(&output, "output", "o", "table", "Output format: `table`, `csv` or `json`")
+	return cmdPowerHistory
+}
+
+// Loads samples from the server or the local sampler
+// If the source is `auto`, local samples are used if the server does not provide power usage data
+func loadPowerSamples(source string, start time.Time) ([]powerSample, string, error) {
+	if source != "local" {
+		samples, err := fetchServerPowerSamples(start)
+		if err == nil {
+			return samples, "server", nil
+		}
+		if err != errEndpointNotFound || source == "server" {
+			return nil, "", fmt.Errorf("Could not fetch power usage history: %s", err.Error())
+		}
+		if Verbose {
+			fmt.Println("The server does not record power usage, using local samples")
+		}
+	}
+	path, err := powerSamplesPath()
+	if err != nil {
+		return nil, "", err
+	}
+	samples, err := readPowerSamples(path, start)
+	if err != nil {
+		return nil, "", fmt.Errorf("Could not read local power samples: %s", err.Error())
+	}
+	return samples, "local", nil
+}
+
+// Retrieves the power usage datapoints recorded by the server
+func fetchServerPowerSamples(start time.Time) ([]powerSample, error) {
+	endpoint := "/api/power/usage/all"
+	if time.Since(start) <= 24*time.Hour {
+		endpoint = "/api/power/usage/day"
+	}
+	s := progress.New(progress.CharsetDots, 150*time.Millisecond)
+	s.Suffix = " Loading power usage history"
+	s.Start()
+	defer s.Stop()
+	res, err := apiRequest("GET", endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	var points []powerDrawPoint
+	if err := json.NewDecoder(res.Body).Decode(&points); err != nil {
+		return nil, sdk.ErrReadResponseBody
+	}
+	samples := make([]powerSample, 0, len(points))
+	for _, point := range points {
+		sampleTime := time.UnixMilli(point.Time)
+		if sampleTime.Before(start) {
+			continue
+		}
+		samples = append(samples, powerSample{
+			Time:        sampleTime,
+			WattsOn:     int(point.On.Watts),
+			WattsOff:    int(point.Off.Watts),
+			SwitchesOn:  int(point.On.SwitchCount),
+			SwitchesOff: int(point.Off.SwitchCount),
+		})
+	}
+	sort.Slice(samples, func(i, j int) bool { return samples[i].Time.Before(samples[j].Time) })
+	return samples, nil
+}
+
+// Returns the path of the local power samples of the current server
+func powerSamplesPath() (string, error) {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("Failed to determine user cache directory: %s", err.Error())
+	}
+	return fmt.Sprintf("%s/%s/power/%s.csv", cacheDir, filePathPrefix, sanitizeFilename(Connection.SmarthomeURL.Host)), nil
+}
+
+// Appends a sample of the given switches to the local samples file
+// Is used by `power watch` so that a history is available even if the server does not record one
+func recordPowerSample(switches []sdk.Switch) error {
+	path, err := powerSamplesPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	sample := powerSample{Time: time.Now()}
+	for _, sw := range switches {
+		if sw.PowerOn {
+			sample.WattsOn += int(sw.Watts)
+			sample.SwitchesOn++
+		} else {
+			sample.WattsOff += int(sw.Watts)
+			sample.SwitchesOff++
+		}
+	}
+	writer := csv.NewWriter(file)
+	if err := writer.Write(encodePowerSample(sample)); err != nil {
+		return err
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// Reads all local samples recorded after `start`
+func readPowerSamples(path string, start time.Time) ([]powerSample, error) {
+	samples := make([]powerSample, 0)
+	err := scanPowerSamples(path, func(sample powerSample, record []string) error {
+		if !sample.Time.Before(start) {
+			samples = append(samples, sample)
+		}
+		return nil
+	})
+	return samples, err
+}
+
+// Calls `handle` for every local sample without reading the entire file into memory
+// A missing file is treated as an empty one
+func scanPowerSamples(path string, handle func(sample powerSample, record []string) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer file.Close()
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = 5
+	reader.ReuseRecord = true
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		sample, err := decodePowerSample(record)
+		if err != nil {
+			return fmt.Errorf("invalid sample in line %d: %s", line, err.Error())
+		}
+		if err := handle(sample, record); err != nil {
+			return err
+		}
+	}
+}
+
+// Removes local samples which are older than `localSampleRetention`
+// The remaining samples are written to a temporary file which then replaces the original one
+func prunePowerSamples() error {
+	path, err := powerSamplesPath()
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil
+	}
+	temp, err := os.CreateTemp(filepath.Dir(path), ".samples-*.csv")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+	defer temp.Close()
+	cutoff := time.Now().Add(-localSampleRetention)
+	writer := csv.NewWriter(temp)
+	err = scanPowerSamples(path, func(sample powerSample, record []string) error {
+		if sample.Time.Before(cutoff) {
+			return nil
+		}
+		return writer.Write(record)
+	})
+	if err != nil {
+		return err
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return err
+	}
+	if err := temp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(temp.Name(), path)
+}
+
+// Writes samples as CSV including a header
+func writePowerSamplesCSV(file *os.File, samples []powerSample) error {
+	writer := csv.NewWriter(file)
+	if err := writer.Write([]string{"time", "watts_on", "watts_off", "switches_on", "switches_off"}); err != nil {
+		return err
+	}
+	for _, sample := range samples {
+		record := encodePowerSample(sample)
+		record[0] = sample.Time.Format(time.RFC3339)
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// Encodes a sample as a CSV record, the time is stored as a Unix timestamp in milliseconds
+func encodePowerSample(sample powerSample) []string {
+	return []string{
+		strconv.FormatInt(sample.Time.UnixMilli(), 10),
+		strconv.Itoa(sample.WattsOn),
+		strconv.Itoa(sample.WattsOff),
+		strconv.Itoa(sample.SwitchesOn),
+		strconv.Itoa(sample.SwitchesOff),
+	}
+}
+
+func decodePowerSample(record []string) (powerSample, error) {
+	values := make([]int64, len(record))
+	for index, field := range record {
+		value, err := strconv.ParseInt(field, 10, 64)
+		if err != nil {
+			return powerSample{}, err
+		}
+		values[index] = value
+	}
+	return powerSample{
+		Time:        time.UnixMilli(values[0]),
+		WattsOn:     int(values[1]),
+		WattsOff:    int(values[2]),
+		SwitchesOn:  int(values[3]),
+		SwitchesOff: int(values[4]),
+	}, nil
+}
+
+// Calculates the consumed energy per hour or day
+// The load of a sample is assumed to last until the next sample (or until now for the last one)
+// If `maxGap` is set, longer intervals are treated as missing data
+func energyPerPeriod(samples []powerSample, group string, maxGap time.Duration) []energyPeriod {
+	periods := make([]energyPeriod, 0)
+	for index, sample := range samples {
+		end := time.Now()
+		if index+1 < len(samples) {
+			end = samples[index+1].Time
+		}
+		if maxGap > 0 && end.Sub(sample.Time) > maxGap {
+			continue
+		}
+		// Split the interval at period boundaries
+		for current := sample.Time; current.Before(end); {
+			beginning := periodStart(current, group)
+			periodEnd := beginning.Add(time.Hour)
+			if group == "day" {
+				periodEnd = beginning.AddDate(0, 0, 1)
+			}
+			until := end
+			if periodEnd.Before(until) {
+				until = periodEnd
+			}
+			kwh := float64(sample.WattsOn) * until.Sub(current).Hours() / 1000
+			if len(periods) == 0 || !periods[len(periods)-1].Start.Equal(beginning) {
+				periods = append(periods, energyPeriod{Start: beginning})
+			}
+			periods[len(periods)-1].Kwh += kwh
+			current = until
+		}
+	}
+	return periods
+}
+
+// Returns the start of the hour or day containing `t`
+func periodStart(t time.Time, group string) time.Time {
+	if group == "day" {
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	}
+	return t.Truncate(time.Hour)
+}
+
+func printEnergyPeriods(periods []energyPeriod, group string, totalKwh float64) {
+	headerFmt := color.New(color.FgGreen, color.Underline).SprintfFunc()
+	columnFmt := color.New(color.FgYellow).SprintfFunc()
+
+	label := "Hour"
+	layout := "2006-01-02 15:00"
+	if group == "day" {
+		label = "Day"
+		layout = "2006-01-02"
+	}
+	// The estimated cost is only displayed if a tariff is configured
+	cost := func(kwh float64) string {
+		return fmt.Sprintf("%.2f %s", kwh*Config.Power.TariffPrice, Config.Power.TariffCurrency)
+	}
+	headers := []interface{}{label, "Energy"}
+	if Config.Power.TariffPrice > 0 {
+		headers = append(headers, "Cost")
+	}
+	tbl := table.New(headers...)
+	tbl.WithHeaderFormatter(headerFmt).WithFirstColumnFormatter(columnFmt)
+	for _, period := range periods {
+		row := []interface{}{period.Start.Format(layout), fmt.Sprintf("%.3f kWh", period.Kwh)}
+		if Config.Power.TariffPrice > 0 {
+			row = append(row, cost(period.Kwh))
+		}
+		tbl.AddRow(row...)
+	}
+	tbl.AddRow()
+	totalRow := []interface{}{"total", fmt.Sprintf("%.3f kWh", totalKwh)}
+	if Config.Power.TariffPrice > 0 {
+		totalRow = append(totalRow, cost(totalKwh))
+	}
+	tbl.AddRow(totalRow...)
+	tbl.Print()
+}
+
+// Renders the load over time as an ASCII chart with one column per time slice
+func renderPowerChart(samples []powerSample, start time.Time, end time.Time, width int, maxGap time.Duration) string {
+	const axisWidth = 8
+	columns := width - axisWidth - 1
+	if columns < 10 {
+		columns = 10
+	}
+	// Determine the load of every column using the most recent sample before the column's end
+	values := make([]int, columns)
+	known := make([]bool, columns)
+	slice := end.Sub(start) / time.Duration(columns)
+	sampleIndex := -1
+	maximum := 0
+	for column := 0; column < columns; column++ {
+		columnEnd := start.Add(slice * time.Duration(column+1))
+		for sampleIndex+1 < len(samples) && !samples[sampleIndex+1].Time.After(columnEnd) {
+			sampleIndex++
+		}
+		if sampleIndex < 0 {
+			continue
+		}
+		if maxGap > 0 && columnEnd.Sub(samples[sampleIndex].Time) > maxGap {
+			continue
+		}
+		values[column] = samples[sampleIndex].WattsOn
+		known[column] = true
+		if values[column] > maximum {
+			maximum = values[column]
+		}
+	}
+
+	var builder strings.Builder
+	for row := powerChartHeight; row >= 1; row-- {
+		threshold := float64(maximum) * float64(row) / powerChartHeight
+		axis := strings.Repeat(" ", axisWidth)
+		if row == powerChartHeight {
+			axis = fmt.Sprintf("%6d W", maximum)
+		} else if row == 1 {
+			axis = fmt.Sprintf("%6d W", 0)
+		}
+		builder.WriteString(axis)
+		builder.WriteString("│")
+		for column := 0; column < columns; column++ {
+			switch {
+			case !known[column]:
+				builder.WriteString(" ")
+			case maximum > 0 && float64(values[column]) >= threshold:
+				builder.WriteString("█")
+			case maximum > 0 && float64(values[column]) >= threshold-float64(maximum)/powerChartHeight/2:
+				builder.WriteString("▄")
+			case row == 1:
+				builder.WriteString("▁")
+			default:
+				builder.WriteString(" ")
+			}
+		}
+		builder.WriteString("\n")
+	}
+	builder.WriteString(strings.Repeat(" ", axisWidth))
+	builder.WriteString("└")
+	builder.WriteString(strings.Repeat("─", columns))
+	builder.WriteString("\n")
+	startLabel := start.Format("01-02 15:04")
+	endLabel := end.Format("01-02 15:04")
+	padding := columns + 1 - len(startLabel) - len(endLabel)
+	if padding < 1 {
+		padding = 1
+	}
+	builder.WriteString(strings.Repeat(" ", axisWidth))
+	builder.WriteString(startLabel)
+	builder.WriteString(strings.Repeat(" ", padding))
+	builder.WriteString(endLabel)
+	builder.WriteString("\n")
+	return builder.String()
+}
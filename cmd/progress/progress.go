@@ -0,0 +1,97 @@
+package progress
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/briandowns/spinner"
+	"golang.org/x/term"
+)
+
+// Is the default time after which an indicator becomes visible
+const DefaultDelay = 200 * time.Millisecond
+
+// Disables all progress indicators, for instance if `--non-interactive` is set
+var NonInteractive bool
+
+// Commonly used character sets
+var (
+	CharsetBraille = []string{"⠏", "⠛", "⠹", "⢸", "⣰", "⣤", "⣆", "⡇"}
+	CharsetDots    = spinner.CharSets[11]
+	CharsetArrows  = spinner.CharSets[59]
+)
+
+// A progress indicator which only becomes visible if an operation takes longer than `Delay`
+// Indicators are never shown if stdout is not a terminal or if `NonInteractive` is set
+type Indicator struct {
+	// Text displayed before the spinner
+	Prefix string
+	// Text displayed after the spinner
+	Suffix string
+	// Printed when the indicator is stopped, regardless of whether it was visible
+	FinalMSG string
+	// Time after which the indicator becomes visible
+	Delay time.Duration
+
+	spinner *spinner.Spinner
+	timer   *time.Timer
+	lock    sync.Mutex
+}
+
+// Creates a new (stopped) indicator
+func New(charset []string, interval time.Duration) *Indicator {
+	return &Indicator{
+		Delay:   DefaultDelay,
+		spinner: spinner.New(charset, interval),
+	}
+}
+
+// Reports whether progress indicators can be displayed
+func Enabled() bool {
+	return !NonInteractive && term.IsTerminal(int(os.Stdout.Fd()))
+}
+
+// Schedules the indicator to become visible after its delay
+// Calling `Start` on a running indicator has no effect
+func (i *Indicator) Start() {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	if i.timer != nil || !Enabled() {
+		return
+	}
+	i.timer = time.AfterFunc(i.Delay, func() {
+		i.lock.Lock()
+		defer i.lock.Unlock()
+		// The indicator might have been stopped in the meantime
+		if i.timer == nil {
+			return
+		}
+		i.spinner.Prefix = i.Prefix
+		i.spinner.Suffix = i.Suffix
+		i.spinner.Start()
+	})
+}
+
+// Hides the indicator without printing `FinalMSG`
+// It can be started again afterwards, for instance after output has been printed
+func (i *Indicator) Pause() {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	if i.timer != nil {
+		i.timer.Stop()
+		i.timer = nil
+	}
+	if i.spinner.Active() {
+		i.spinner.Stop()
+	}
+}
+
+// Hides the indicator and prints `FinalMSG`
+func (i *Indicator) Stop() {
+	i.Pause()
+	if i.FinalMSG != "" {
+		fmt.Print(i.FinalMSG)
+	}
+}
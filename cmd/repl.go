@@ -7,9 +7,9 @@ import (
 	"strings"
 	"time"
 
-	"github.com/briandowns/spinner"
 	"github.com/chzyer/readline"
 
+	"github.com/smarthome-go/cli/cmd/progress"
 	"github.com/smarthome-go/cli/cmd/workspace"
 	"github.com/smarthome-go/sdk"
 )
@@ -18,6 +18,8 @@ var (
 	History   []string
 	Switches  []sdk.Switch
 	completer *readline.PrefixCompleter
+	// If set, every executed input is recorded to this transcript file
+	recordFile string
 )
 
 func filterInput(r rune) (rune, bool) {
@@ -39,7 +41,7 @@ func initCompleter() {
 			readline.PcItem(fmt.Sprintf("('%s', off)", switchItem.Id)),
 		)
 	}
-	completer = readline.NewPrefixCompleter(
+	items := []readline.PrefixCompleterInterface{
 		readline.PcItem("switch",
 			switchCompletions...,
 		),
@@ -61,7 +63,34 @@ func initCompleter() {
 		readline.PcItem("#verbose"),
 		readline.PcItem("#wipe"),
 		readline.PcItem("#reload"),
-	)
+		readline.PcItem("#history",
+			readline.PcItem("grep"),
+			readline.PcItem("export"),
+		),
+	}
+	// Update an existing completer in place so that running readline instances pick up the changes
+	if completer != nil {
+		completer.SetChildren(items)
+		return
+	}
+	completer = readline.NewPrefixCompleter(items...)
+}
+
+// Returns the readline configuration used by the REPL
+// History is saved manually (see `recordHistory`) so that exclusion patterns can be applied
+func newReadlineConfig(prompt string, historyFile string) *readline.Config {
+	return &readline.Config{
+		Prompt:          prompt,
+		HistoryFile:     historyFile,
+		HistoryLimit:    historySize(),
+		AutoComplete:    completer,
+		InterruptPrompt: "^C",
+		EOFPrompt:       "exit",
+
+		DisableAutoSaveHistory: true,
+		HistorySearchFold:      true,
+		FuncFilterInputRune:    filterInput,
+	}
 }
 
 func StartRepl() {
@@ -69,7 +98,7 @@ func StartRepl() {
 	if err != nil {
 		panic(fmt.Sprintf("Encountered impossible error: %s", err.Error()))
 	}
-	s := spinner.New(spinner.CharSets[11], 100*time.Millisecond)
+	s := progress.New(progress.CharsetDots, 100*time.Millisecond)
 	s.Suffix = " Preparing REPL"
 	if Verbose {
 		fmt.Println("Fetching switches from Smarthome")
@@ -97,28 +126,37 @@ func StartRepl() {
 		Connection.SmarthomeGoVersion,
 		Config.Connection.SmarthomeUrl,
 	)
-	cacheDir, err := os.UserCacheDir()
-	var historyFile string
-	if err != nil {
-		fmt.Println("Failed to setup default history, user has no default caching directory, using fallback at `/tmp`")
-		historyFile = "/tmp/homescript.history"
-	} else {
-		historyFile = fmt.Sprintf("%s/homescript.history", cacheDir)
+	historyFile := historyFilePath(username)
+	loadHistory(historyFile)
+	initHistoryExcludes()
+	session := &replSession{
+		username:  username,
+		hostname:  Connection.SmarthomeURL.Hostname(),
+		connected: true,
 	}
-	l, err := readline.NewEx(&readline.Config{
-		Prompt:          fmt.Sprintf("\x1b[32m%s\x1b[0m@\x1b[34m%s\x1b[0m> ", username, Connection.SmarthomeURL.Hostname()),
-		HistoryFile:     historyFile,
-		AutoComplete:    completer,
-		InterruptPrompt: "^C",
-		EOFPrompt:       "exit",
-
-		HistorySearchFold:   true,
-		FuncFilterInputRune: filterInput,
-	})
+	l, err := readline.NewEx(newReadlineConfig(session.prompt(), historyFile))
 	if err != nil {
 		panic(err)
 	}
 	defer l.Close()
+	session.readline = l
+
+	var recorder *transcriptRecorder
+	if recordFile != "" {
+		recorder, err = newTranscriptRecorder(recordFile)
+		if err != nil {
+			fmt.Printf("Could not open transcript file `%s`: %s\n", recordFile, err.Error())
+			os.Exit(1)
+		}
+		defer recorder.close()
+		fmt.Printf("Recording session to \x1b[90m%s\x1b[0m\n", recordFile)
+	}
+
+	// Keep the session alive and re-authenticate transparently if it expires
+	workspace.ReconnectHook = session.reconnectHook
+	defer func() { workspace.ReconnectHook = nil }()
+	stopKeepalive := session.startKeepalive()
+	defer stopKeepalive()
 
 	for {
 		line, err := l.Readline()
@@ -131,108 +169,118 @@ func StartRepl() {
 		} else if err == io.EOF {
 			break
 		}
-		if strings.ReplaceAll(line, " ", "") == "#exit" {
-			os.Exit(0)
-		}
-		if strings.ReplaceAll(line, " ", "") == "#verbose" {
-			Verbose = true
-			fmt.Println("Set output mode to verbose")
-			continue
-		}
-		if strings.ReplaceAll(line, " ", "") == "#switches" {
-			listSwitches()
-			continue
-		}
-		if strings.ReplaceAll(line, " ", "") == "#power" {
-			powerStats()
-			continue
-		}
-		if strings.ReplaceAll(line, " ", "") == "#hmsls" {
-			workspace.ListAll(Connection)
-			continue
+		recordHistory(l, line)
+		session.connLock.Lock()
+		session.applyProbeResult()
+		session.handleLine(line, recorder)
+		session.connLock.Unlock()
+	}
+}
+
+// Executes a single line of REPL input, either a CLI command or Homescript code
+// The caller must hold `connLock`
+func (r *replSession) handleLine(line string, recorder *transcriptRecorder) {
+	if strings.ReplaceAll(line, " ", "") == "#exit" {
+		os.Exit(0)
+	}
+	if strings.ReplaceAll(line, " ", "") == "#verbose" {
+		Verbose = true
+		fmt.Println("Set output mode to verbose")
+		return
+	}
+	if strings.ReplaceAll(line, " ", "") == "#switches" {
+		listSwitches(switchFilter{}, "table")
+		return
+	}
+	if strings.ReplaceAll(line, " ", "") == "#power" {
+		powerStats(switchFilter{})
+		return
+	}
+	if strings.ReplaceAll(line, " ", "") == "#hmsls" {
+		workspace.ListAll(Connection)
+		return
+	}
+	if strings.ReplaceAll(line, " ", "") == "#debug" {
+		printDebugInfo()
+		return
+	}
+	if strings.ReplaceAll(line, " ", "") == "#config" {
+		printConfig()
+		return
+	}
+	if strings.ReplaceAll(line, " ", "") == "#wipe" {
+		if Verbose {
+			fmt.Println("History has been deleted.")
 		}
-		if strings.ReplaceAll(line, " ", "") == "#debug" {
-			printDebugInfo()
-			continue
+		r.readline.ResetHistory()
+		History = make([]string, 0)
+		return
+	}
+	if fields := strings.Fields(line); len(fields) > 0 && fields[0] == "#history" {
+		historyCommand(fields[1:])
+		return
+	}
+	if strings.ReplaceAll(line, " ", "") == "#reload" {
+		// Reconnect using the stored credentials
+		if err := r.reconnect(); err != nil {
+			fmt.Printf("Could not reload session: %s\n", err.Error())
+			return
 		}
-		if strings.ReplaceAll(line, " ", "") == "#config" {
-			printConfig()
-			continue
+
+		if Verbose {
+			fmt.Println("Updating available switches...")
 		}
-		if strings.ReplaceAll(line, " ", "") == "#wipe" {
-			if Verbose {
-				fmt.Println("History has been deleted.")
-			}
-			l.ResetHistory()
-			continue
+		// Fetch the user switches again
+		switches, err := Connection.GetPersonalSwitches()
+		if err != nil {
+			fmt.Println(err.Error())
+		} else {
+			Switches = switches
 		}
-		if strings.ReplaceAll(line, " ", "") == "#reload" {
-			if Verbose {
-				fmt.Printf("Reconnecting.... (using %s@%s)\n",
-					username,
-					Connection.SmarthomeURL.Hostname(),
-				)
-			}
-			// Reconnect
-			InitConn()
 
-			if Verbose {
-				fmt.Println("Updating available switches...")
-			}
-			// Fetch the user switches again
-			switches, err := Connection.GetPersonalSwitches()
-			if err != nil {
-				fmt.Println(err.Error())
-			}
-			Switches = switches
+		// Generate new autocompletions based on new switches
+		// The completer is updated in place, therefore the readline instance can be reused
+		initCompleter()
+		r.updatePrompt()
+		fmt.Println("Session has been reloaded.")
+		return
+	}
 
-			// Generate new autocompletions based on new switches
-			initCompleter()
-			l.Refresh()
-
-			// Reinitialize readline
-			l, err = readline.NewEx(&readline.Config{
-				Prompt: fmt.Sprintf("\x1b[32m%s\x1b[0m@\x1b[34m%s\x1b[0m> ",
-					username,
-					Connection.SmarthomeURL.Hostname(),
-				),
-				HistoryFile:     historyFile,
-				AutoComplete:    completer,
-				InterruptPrompt: "^C",
-				EOFPrompt:       "exit",
-
-				HistorySearchFold:   true,
-				FuncFilterInputRune: filterInput,
-			})
-			if err != nil {
-				fmt.Println(err.Error())
-			}
-			fmt.Println("Session has been reloaded.")
-			continue
+	// Try to recover a lost connection before executing code
+	if !r.isConnected() {
+		if err := r.reconnect(); err != nil {
+			fmt.Printf("Not connected to Smarthome: %s\n=> Use \x1b[90m#reload\x1b[0m to retry.\n", err.Error())
+			return
 		}
+	}
 
-		if Verbose {
-			fmt.Printf("Executing instruction. (using %s@%s)\n",
-				username,
-				Connection.SmarthomeURL.Hostname(),
-			)
-		}
-		startTime := time.Now()
-		exitCode := workspace.RunCode(
-			Connection,
-			line,
-			make(map[string]string, 0),
-			"repl",
-		)
-		var display string
-		if exitCode != 0 {
-			display = fmt.Sprintf(" \x1b[31m[%d]\x1b[0m", exitCode)
-		}
-		l.SetPrompt(fmt.Sprintf("\x1b[32m%s\x1b[0m@\x1b[34m%s\x1b[0m%s[\x1b[90m%.2fs\x1b[0m]> ",
-			username,
+	if Verbose {
+		fmt.Printf("Executing instruction. (using %s@%s)\n",
+			r.username,
 			Connection.SmarthomeURL.Hostname(),
-			display,
-			time.Since(startTime).Seconds()),
 		)
 	}
+	startTime := time.Now()
+	// Ctrl+C cancels the execution instead of terminating the REPL
+	ctx, cancel := homescriptContext()
+	defer cancel()
+	output, exitCode := workspace.RunCodeWithOutput(
+		ctx,
+		os.Stdout,
+		Connection,
+		line,
+		make(map[string]string, 0),
+		"repl",
+	)
+	if recorder != nil {
+		recorder.record(line, output, exitCode, startTime)
+	}
+	var display string
+	if exitCode != 0 {
+		display = fmt.Sprintf(" \x1b[31m[%d]\x1b[0m", exitCode)
+	}
+	r.setLastResult(fmt.Sprintf("%s[\x1b[90m%.2fs\x1b[0m]",
+		display,
+		time.Since(startTime).Seconds()),
+	)
 }
@@ -0,0 +1,227 @@
+package cmd
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/smarthome-go/sdk"
+)
+
+// How many suggestions are displayed for an unknown switch
+const maxSwitchSuggestions = 3
+
+// Selects switches by ID, name, glob pattern (matching IDs or names) and room
+// Literal references are resolved by exact ID first and by exact name second, unknown references result in an error with suggestions
+// If no patterns are given, every switch of the room (or all switches if `all` is set) is selected, a room always restricts the selection
+func selectSwitches(switches []sdk.Switch, patterns []string, room string, all bool) ([]sdk.Switch, error) {
+	selected := make([]sdk.Switch, 0)
+	contained := make(map[string]bool)
+	add := func(sw sdk.Switch) {
+		if !contained[sw.Id] {
+			contained[sw.Id] = true
+			selected = append(selected, sw)
+		}
+	}
+	candidates := make([]sdk.Switch, 0, len(switches))
+	for _, sw := range switches {
+		if room == "" || sw.RoomId == room {
+			candidates = append(candidates, sw)
+		}
+	}
+	for _, pattern := range patterns {
+		if !strings.ContainsAny(pattern, "*?[") {
+			// The user's switch might belong to another room, which is not a permission problem
+			if _, found := findSwitch(candidates, pattern); !found && room != "" {
+				if other, found := findSwitch(switches, pattern); found {
+					return nil, fmt.Errorf("Switch `%s` is not in room `%s` (it belongs to room `%s`).", pattern, room, other.RoomId)
+				}
+			}
+			sw, err := resolveSwitch(candidates, pattern)
+			if err != nil {
+				return nil, err
+			}
+			add(sw)
+			continue
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("Invalid switch pattern `%s`: %s", pattern, err.Error())
+		}
+		matched := false
+		for _, sw := range candidates {
+			idMatches, _ := path.Match(pattern, sw.Id)
+			nameMatches, _ := path.Match(pattern, sw.Name)
+			if idMatches || nameMatches {
+				add(sw)
+				matched = true
+			}
+		}
+		if !matched {
+			return nil, fmt.Errorf("No switch matches `%s`.", pattern)
+		}
+	}
+	if len(patterns) == 0 {
+		for _, sw := range candidates {
+			if all || room != "" {
+				add(sw)
+			}
+		}
+	}
+	if len(selected) == 0 {
+		return nil, fmt.Errorf("No switches matched the selection.")
+	}
+	return selected, nil
+}
+
+// Resolves a reference to a single switch by its exact ID or its exact name
+func resolveSwitch(switches []sdk.Switch, reference string) (sdk.Switch, error) {
+	for _, sw := range switches {
+		if sw.Id == reference {
+			return sw, nil
+		}
+	}
+	byName := make([]sdk.Switch, 0)
+	for _, sw := range switches {
+		if sw.Name == reference {
+			byName = append(byName, sw)
+		}
+	}
+	switch len(byName) {
+	case 0:
+		return sdk.Switch{}, unknownSwitchError(switches, reference)
+	case 1:
+		return byName[0], nil
+	}
+	ids := make([]string, 0, len(byName))
+	for _, sw := range byName {
+		ids = append(ids, sw.Id)
+	}
+	return sdk.Switch{}, fmt.Errorf("The name `%s` is ambiguous, please use one of the IDs: %s", reference, strings.Join(ids, ", "))
+}
+
+// Returns the first switch whose ID or name equals the reference
+func findSwitch(switches []sdk.Switch, reference string) (sdk.Switch, bool) {
+	for _, sw := range switches {
+		if sw.Id == reference || sw.Name == reference {
+			return sw, true
+		}
+	}
+	return sdk.Switch{}, false
+}
+
+// Creates the error for a switch which does not exist (or is not accessible) including suggestions
+// If all switches can be retrieved, switches which exist but are not accessible are reported as such
+func unknownSwitchError(switches []sdk.Switch, reference string) error {
+	if allSwitches, err := Connection.GetAllSwitches(); err == nil {
+		for _, sw := range allSwitches {
+			if sw.Id == reference || sw.Name == reference {
+				return fmt.Errorf("Permission denied: you do not have access to switch `%s`.", reference)
+			}
+		}
+	}
+	message := fmt.Sprintf("Switch `%s` does not exist or you do not have access to it.", reference)
+	if suggestions := suggestSwitches(switches, reference); len(suggestions) > 0 {
+		message += fmt.Sprintf("\nDid you mean: %s?", strings.Join(suggestions, ", "))
+	}
+	return fmt.Errorf("%s", message)
+}
+
+// Returns the switches whose ID or name is most similar to the reference
+func suggestSwitches(switches []sdk.Switch, reference string) []string {
+	type suggestion struct {
+		text     string
+		distance int
+	}
+	reference = strings.ToLower(reference)
+	suggestions := make([]suggestion, 0)
+	for _, sw := range switches {
+		distance := levenshtein(reference, strings.ToLower(sw.Id))
+		if nameDistance := levenshtein(reference, strings.ToLower(sw.Name)); nameDistance < distance {
+			distance = nameDistance
+		}
+		// Substrings are considered to be very similar
+		if strings.Contains(strings.ToLower(sw.Id), reference) || strings.Contains(strings.ToLower(sw.Name), reference) {
+			distance = 1
+		}
+		// Only suggest switches which differ in less than half of the characters
+		if distance > len(reference)/2+1 {
+			continue
+		}
+		text := sw.Id
+		if sw.Name != "" && sw.Name != sw.Id {
+			text = fmt.Sprintf("%s (%s)", sw.Id, sw.Name)
+		}
+		suggestions = append(suggestions, suggestion{text: text, distance: distance})
+	}
+	sort.SliceStable(suggestions, func(i, j int) bool { return suggestions[i].distance < suggestions[j].distance })
+	result := make([]string, 0, maxSwitchSuggestions)
+	for index := 0; index < len(suggestions) && index < maxSwitchSuggestions; index++ {
+		result = append(result, suggestions[index].text)
+	}
+	return result
+}
+
+// Computes the edit distance between two strings
+func levenshtein(a string, b string) int {
+	runesA, runesB := []rune(a), []rune(b)
+	previous := make([]int, len(runesB)+1)
+	current := make([]int, len(runesB)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(runesA); i++ {
+		current[0] = i
+		for j := 1; j <= len(runesB); j++ {
+			cost := 1
+			if runesA[i-1] == runesB[j-1] {
+				cost = 0
+			}
+			current[j] = minInt(minInt(previous[j]+1, current[j-1]+1), previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(runesB)]
+}
+
+func minInt(a int, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// Describes an error returned while changing the power state of a switch
+func describePowerError(err error) string {
+	switch err {
+	case sdk.ErrPermissionDenied:
+		return "permission denied: you do not have access to this switch"
+	case sdk.ErrUnprocessableEntity:
+		return "the switch does not exist"
+	case sdk.ErrConnFailed:
+		return "network connection to Smarthome was interrupted"
+	case sdk.ErrServiceUnavailable:
+		return "Smarthome is currently unavailable"
+	}
+	return err.Error()
+}
+
+// Completes the IDs of the user's switches
+func completeSwitchIds(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if err := connectForCompletion(); err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+	switches, err := Connection.GetPersonalSwitches()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+	completions := make([]string, 0)
+	for _, sw := range switches {
+		if strings.HasPrefix(sw.Id, toComplete) {
+			completions = append(completions, fmt.Sprintf("%s\t%s", sw.Id, sw.Name))
+		}
+	}
+	return completions, cobra.ShellCompDirectiveNoFileComp
+}
@@ -0,0 +1,229 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/rodaine/table"
+	"github.com/spf13/cobra"
+
+	"github.com/smarthome-go/sdk"
+)
+
+// Summary of a room, derived from the switches it contains
+type roomSummary struct {
+	Id         string `json:"id"`
+	Switches   int    `json:"switches"`
+	SwitchesOn int    `json:"switchesOn"`
+	Watts      int64  `json:"watts"` // Current load of the switches which are on
+}
+
+// JSON representation of a switch
+type switchJSON struct {
+	Id      string `json:"id"`
+	Name    string `json:"name"`
+	RoomId  string `json:"roomId"`
+	PowerOn bool   `json:"powerOn"`
+	Watts   uint16 `json:"watts"`
+}
+
+func createCmdRooms() *cobra.Command {
+	cmdRooms := &cobra.Command{
+		Use:   "rooms",
+		Short: "Rooms Subcommand",
+		Long:  "Rooms subcommand for viewing rooms and controlling all switches of a room",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := cmd.Help(); err != nil {
+				panic(err.Error())
+			}
+		},
+	}
+
+	var listOutput string
+	cmdRoomsList := &cobra.Command{
+		Use:   "ls",
+		Short: "List Rooms",
+		Long:  "Lists all rooms containing your switches including their current load",
+		Args:  cobra.NoArgs,
+		PreRun: func(cmd *cobra.Command, args []string) {
+			readConfigFile()
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			validateOutputFormat(listOutput)
+			InitConn()
+			rooms := summarizeRooms(fetchPersonalSwitches())
+			if listOutput == "json" {
+				printJSON(rooms)
+				return
+			}
+			if len(rooms) == 0 {
+				fmt.Println("You do not have access to any switches.")
+				return
+			}
+			headerFmt := color.New(color.FgGreen, color.Underline).SprintfFunc()
+			columnFmt := color.New(color.FgYellow).SprintfFunc()
+
+			tbl := table.New("Room", "Switches", "On", "Watts")
+			tbl.WithHeaderFormatter(headerFmt).WithFirstColumnFormatter(columnFmt)
+			for _, room := range rooms {
+				tbl.AddRow(room.Id, room.Switches, room.SwitchesOn, room.Watts)
+			}
+			tbl.Print()
+		},
+	}
+	cmdRoomsList.Flags().StringVarP(&listOutput, "output", "o", "table", "Output format: `table` or `json`")
+
+	var showOutput string
+	cmdRoomsShow := &cobra.Command{
+		Use:               "show [room-id]",
+		Short:             "Show Room",
+		Long:              "Lists all switches of a room",
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: completeRoomIds,
+		PreRun: func(cmd *cobra.Command, args []string) {
+			readConfigFile()
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			validateOutputFormat(showOutput)
+			InitConn()
+			switches := roomSwitches(fetchPersonalSwitches(), args[0])
+			if showOutput == "json" {
+				printJSON(switchesToJSON(switches))
+				return
+			}
+			headerFmt := color.New(color.FgGreen, color.Underline).SprintfFunc()
+			columnFmt := color.New(color.FgYellow).SprintfFunc()
+
+			tbl := table.New("ID", "Name", "Power", "Watts")
+			tbl.WithHeaderFormatter(headerFmt).WithFirstColumnFormatter(columnFmt)
+			for _, sw := range switches {
+				tbl.AddRow(sw.Id, sw.Name, powerLabel(sw.PowerOn), sw.Watts)
+			}
+			tbl.Print()
+		},
+	}
+	cmdRoomsShow.Flags().StringVarP(&showOutput, "output", "o", "table", "Output format: `table` or `json`")
+
+	cmdRooms.AddCommand(cmdRoomsList)
+	cmdRooms.AddCommand(cmdRoomsShow)
+	cmdRooms.AddCommand(createCmdRoomPower("on", "Turn Room On", true))
+	cmdRooms.AddCommand(createCmdRoomPower("off", "Turn Room Off", false))
+
+	return cmdRooms
+}
+
+// Creates a command which turns all switches of a room on or off
+func createCmdRoomPower(action string, short string, powerOn bool) *cobra.Command {
+	var dryRun bool
+	cmd := &cobra.Command{
+		Use:               fmt.Sprintf("%s [room-id]", action),
+		Short:             short,
+		Long:              fmt.Sprintf("Turns all switches of a room %s", action),
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: completeRoomIds,
+		PreRun: func(cmd *cobra.Command, args []string) {
+			readConfigFile()
+			InitConn()
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			switches := roomSwitches(fetchPersonalSwitches(), args[0])
+			exitCode, _ := runPowerChanges(action, powerChanges(switches, func(sw sdk.Switch) bool { return powerOn }), dryRun)
+			os.Exit(exitCode)
+		},
+	}
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Only show what would be changed")
+	return cmd
+}
+
+func switchesToJSON(switches []sdk.Switch) []switchJSON {
+	result := make([]switchJSON, 0, len(switches))
+	for _, sw := range switches {
+		result = append(result, switchJSON{
+			Id:      sw.Id,
+			Name:    sw.Name,
+			RoomId:  sw.RoomId,
+			PowerOn: sw.PowerOn,
+			Watts:   sw.Watts,
+		})
+	}
+	return result
+}
+
+// Groups switches by room, sorted by the room ID
+func summarizeRooms(switches []sdk.Switch) []roomSummary {
+	rooms := make(map[string]*roomSummary)
+	for _, sw := range switches {
+		room, exists := rooms[sw.RoomId]
+		if !exists {
+			room = &roomSummary{Id: sw.RoomId}
+			rooms[sw.RoomId] = room
+		}
+		room.Switches++
+		if sw.PowerOn {
+			room.SwitchesOn++
+			room.Watts += int64(sw.Watts)
+		}
+	}
+	result := make([]roomSummary, 0, len(rooms))
+	for _, room := range rooms {
+		result = append(result, *room)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Id < result[j].Id })
+	return result
+}
+
+// Returns the switches of a room or exits with suggestions if the room does not exist
+func roomSwitches(switches []sdk.Switch, roomId string) []sdk.Switch {
+	result := make([]sdk.Switch, 0)
+	for _, sw := range switches {
+		if sw.RoomId == roomId {
+			result = append(result, sw)
+		}
+	}
+	if len(result) > 0 {
+		return result
+	}
+	message := fmt.Sprintf("Room `%s` does not exist or does not contain any of your switches.", roomId)
+	candidates := make([]string, 0)
+	for _, room := range summarizeRooms(switches) {
+		if levenshtein(strings.ToLower(roomId), strings.ToLower(room.Id)) <= len(roomId)/2+1 {
+			candidates = append(candidates, room.Id)
+		}
+	}
+	if len(candidates) > 0 {
+		message += fmt.Sprintf("\nDid you mean: %s?", strings.Join(candidates, ", "))
+	}
+	fmt.Println(message)
+	os.Exit(1)
+	return nil
+}
+
+// Completes a room ID as the first argument of a command
+func completeRoomIds(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	return completeRoomFlag(cmd, args, toComplete)
+}
+
+// Completes room IDs using the rooms of the user's switches
+func completeRoomFlag(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if err := connectForCompletion(); err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+	switches, err := Connection.GetPersonalSwitches()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+	completions := make([]string, 0)
+	for _, room := range summarizeRooms(switches) {
+		if strings.HasPrefix(room.Id, toComplete) {
+			completions = append(completions, fmt.Sprintf("%s\t%d switch(es)", room.Id, room.Switches))
+		}
+	}
+	return completions, cobra.ShellCompDirectiveNoFileComp
+}
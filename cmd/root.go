@@ -4,10 +4,10 @@ import (
 	"fmt"
 	"os"
 	"strings"
-	"time"
 
 	"github.com/spf13/cobra"
 
+	"github.com/smarthome-go/cli/cmd/progress"
 	"github.com/smarthome-go/cli/cmd/workspace"
 	"github.com/smarthome-go/sdk"
 )
@@ -53,103 +53,102 @@ var (
 )
 
 func Execute() {
-	cmdRun := &cobra.Command{
-		Use:   "run [filename] [key:value]",
-		Short: "Run a Homescript file",
-		Long:  "Runs a local Homescript file with arguments on the Smarthome server",
+	cmdPipeIn := &cobra.Command{
+		Use:   "pipe",
+		Short: "Run Code via Stdin",
+		Long:  "Run code via Stdin without interactive prompts and output. Ideal for bash-based scripting.",
 		Args:  cobra.MinimumNArgs(1),
 		PreRun: func(cmd *cobra.Command, args []string) {
 			readConfigFile()
 		},
 		Run: func(cmd *cobra.Command, args []string) {
-			startTime := time.Now()
-			// Read file
-			content, err := os.ReadFile(args[0])
-			if err != nil {
-				fmt.Printf("Could not execute Homescript file '%s' due to fs error: %s\n", args[0], err.Error())
-				os.Exit(1)
-			}
-			// Prepare Homescript arguments
-			hmsArgs, err := processHmsArgs(args[1:])
-			if err != nil {
-				fmt.Println(err.Error())
-				os.Exit(1)
-			}
-			// Initialize Smarthome connection
 			InitConn()
-			// Execute code
-			exitCode := workspace.RunCode(
+			ctx, cancel := homescriptContext()
+			defer cancel()
+			workspace.RunCode(
+				ctx,
 				Connection,
-				string(content),
-				hmsArgs,
-				args[0],
+				strings.Join(args, "\n"),
+				make(map[string]string, 0),
+				"stdin",
 			)
-			if exitCode != 0 {
-				fmt.Printf("Homescript terminated with exit code: %d \x1b[90m[%.2fs]\x1b[1;0m\n", exitCode, time.Since(startTime).Seconds())
-			} else {
-				fmt.Printf("Homescript was executed successfully: %d \x1b[90m[%.2fs]\x1b[1;0m\n", exitCode, time.Since(startTime).Seconds())
-			}
-			os.Exit(exitCode)
 		},
 	}
-	cmdInfo := &cobra.Command{
-		Use:   "debug",
-		Short: "Server Debug Info",
-		Long:  "Prints debugging information about the Smarthome server",
-		Args:  cobra.NoArgs,
+	cmdReplay := &cobra.Command{
+		Use:   "replay [transcript.jsonl]",
+		Short: "Replay a REPL transcript",
+		Long:  "Re-executes a transcript recorded using `--record` and reports every entry whose exit code or output differs",
+		Args:  cobra.ExactArgs(1),
 		PreRun: func(cmd *cobra.Command, args []string) {
 			readConfigFile()
 		},
 		Run: func(cmd *cobra.Command, args []string) {
 			InitConn()
-			printDebugInfo()
-		},
-	}
-	cmdPipeIn := &cobra.Command{
-		Use:   "pipe",
-		Short: "Run Code via Stdin",
-		Long:  "Run code via Stdin without interactive prompts and output. Ideal for bash-based scripting.",
-		Args:  cobra.MinimumNArgs(1),
-		PreRun: func(cmd *cobra.Command, args []string) {
-			readConfigFile()
-		},
-		Run: func(cmd *cobra.Command, args []string) {
-			InitConn()
-			workspace.RunCode(Connection,
-				strings.Join(args, "\n"),
-				make(map[string]string, 0),
-				"stdin",
-			)
+			if replayTranscript(args[0]) != 0 {
+				os.Exit(1)
+			}
 		},
 	}
+	var (
+		switchesFilter switchFilter
+		switchesOutput string
+	)
 	cmdListSwitches := &cobra.Command{
 		Use:   "switches",
 		Short: "List switches",
-		Long:  "List switches of the current user",
+		Long:  "List switches of the current user (or all switches using `--all`), optionally filtered and sorted",
 		Args:  cobra.NoArgs,
 		PreRun: func(cmd *cobra.Command, args []string) {
 			readConfigFile()
 		},
 		Run: func(cmd *cobra.Command, args []string) {
+			validateOutputFormat(switchesOutput)
+			if err := switchesFilter.validate(); err != nil {
+				fmt.Println(err.Error())
+				os.Exit(1)
+			}
 			InitConn()
-			listSwitches()
+			listSwitches(switchesFilter, switchesOutput)
 		},
 	}
+	switchesFilter.addFlags(cmdListSwitches, true)
+	cmdListSwitches.Flags().StringVarP(&switchesOutput, "output", "o", "table", "Output format: `table` or `json`")
 
-	rootCmd.AddCommand(cmdRun)
-	rootCmd.AddCommand(cmdInfo)
+	rootCmd.AddCommand(createCmdRun())
+	rootCmd.AddCommand(createCmdDebug())
 	rootCmd.AddCommand(cmdPipeIn)
+	rootCmd.AddCommand(cmdReplay)
 	rootCmd.AddCommand(cmdListSwitches)
 
 	// Subcommands
 	rootCmd.AddCommand(createCmdConfig())
 	rootCmd.AddCommand(createCmdWs())
 	rootCmd.AddCommand(createCmdPower())
+	rootCmd.AddCommand(createCmdRooms())
+	rootCmd.AddCommand(createCmdHealth())
+	rootCmd.AddCommand(createCmdExporter())
+	rootCmd.AddCommand(createCmdNodes())
+	rootCmd.AddCommand(createCmdDoctor())
+	rootCmd.AddCommand(createCmdExec())
+
+	rootCmd.Flags().StringVar(&recordFile, "record", "", "Records every REPL input and its result to a JSON lines transcript")
 
 	rootCmd.PersistentFlags().BoolVarP(&Verbose, "verbose", "v", false, "Enables verbose output")
+	rootCmd.PersistentFlags().BoolVar(&progress.NonInteractive, "non-interactive", false, "Disables progress indicators and other interactive output")
 	rootCmd.PersistentFlags().StringVarP(&overrideConfig.Credentials.Username, "username", "u", "", "Smarthome-user used for the connection")
 	rootCmd.PersistentFlags().StringVarP(&overrideConfig.Credentials.Password, "password", "p", "", "The user's password used for connection")
 	rootCmd.PersistentFlags().StringVarP(&overrideConfig.Connection.SmarthomeUrl, "ip", "i", "", "URL of the target Smarthome instance")
+	rootCmd.PersistentFlags().StringVar(&overrideConfig.Connection.CaBundle, "ca-bundle", "", "PEM file of CA certificates to trust in addition to the system's")
+	rootCmd.PersistentFlags().StringVar(&overrideConfig.Connection.ClientCert, "client-cert", "", "PEM encoded client certificate for mutual TLS")
+	rootCmd.PersistentFlags().StringVar(&overrideConfig.Connection.ClientKey, "client-key", "", "PEM encoded key of the client certificate")
+	rootCmd.PersistentFlags().StringSliceVar(&overrideConfig.Connection.PinSha256, "pin-sha256", nil, "Base64 encoded SHA-256 hash of the server's public key (can be repeated)")
+	rootCmd.PersistentFlags().BoolVar(&overrideConfig.Connection.InsecureSkipVerify, "insecure-skip-verify", false, "Disables the verification of the server's certificate (insecure)")
+	rootCmd.PersistentFlags().DurationVar(&timeoutFlag, "timeout", 0, "Timeout for executing and linting Homescript (overrides the configuration). Without output streaming support on the server, cancelling a stored Homescript terminates all of its running jobs and arbitrary code cannot be terminated")
+	rootCmd.PersistentFlags().BoolVar(&noColorFlag, "no-color", false, "Disables colors in Homescript error messages and tables")
+	rootCmd.PersistentFlags().BoolVar(&noStreamFlag, "no-stream", false, "Print Homescript output after completion instead of streaming it")
+
+	// Stop running jobs on the server if an execution is cancelled
+	workspace.TerminateHook = terminateHomescript
 
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Fprintln(os.Stderr, err.Error())
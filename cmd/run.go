@@ -0,0 +1,240 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/rodaine/table"
+	"github.com/spf13/cobra"
+
+	"github.com/smarthome-go/cli/cmd/progress"
+	"github.com/smarthome-go/cli/cmd/workspace"
+)
+
+// Result of executing a single local Homescript file
+type runResult struct {
+	File       string `json:"file"`
+	ExitCode   int    `json:"exitCode"`
+	DurationMs int64  `json:"durationMs"`
+	FirstError string `json:"firstError,omitempty"`
+	Output     string `json:"output"`
+	Skipped    bool   `json:"skipped"`
+}
+
+// Report which is printed using `--output json`
+type runReport struct {
+	ExitCode int         `json:"exitCode"`
+	Results  []runResult `json:"results"`
+}
+
+func createCmdRun() *cobra.Command {
+	var (
+		parallel int
+		failFast bool
+		output   string
+	)
+	cmdRun := &cobra.Command{
+		Use:   "run [filename|glob...] [key=value...]",
+		Short: "Run Homescript files",
+		Long: "Runs one or more local Homescript files with arguments on the Smarthome server.\n" +
+			"Files may be given as glob patterns, for instance `scripts/*.hms`.\n" +
+			"Arguments containing a separator ('=' or ':') are passed to every file, unless they name an existing file.",
+		Args: cobra.MinimumNArgs(1),
+		PreRun: func(cmd *cobra.Command, args []string) {
+			readConfigFile()
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			if output != "table" && output != "json" {
+				fmt.Printf("Invalid output format `%s`: expected `table` or `json`.\n", output)
+				os.Exit(1)
+			}
+			if parallel < 1 {
+				fmt.Println("The number of parallel executions must be at least 1.")
+				os.Exit(1)
+			}
+			files, argTokens, err := splitRunArgs(args)
+			if err != nil {
+				fmt.Println(err.Error())
+				os.Exit(1)
+			}
+			hmsArgs, err := collectHmsArgs(argTokens)
+			if err != nil {
+				fmt.Println(err.Error())
+				os.Exit(1)
+			}
+			if output == "json" {
+				// Stdout must only contain the report, everything else is written to stderr
+				progress.NonInteractive = true
+				InitConn()
+				results, exitCode := runFiles(os.Stderr, files, hmsArgs, parallel, failFast)
+				encoder := json.NewEncoder(os.Stdout)
+				encoder.SetIndent("", "  ")
+				if err := encoder.Encode(runReport{ExitCode: exitCode, Results: results}); err != nil {
+					fmt.Fprintf(os.Stderr, "Could not encode report: %s\n", err.Error())
+					os.Exit(1)
+				}
+				os.Exit(exitCode)
+			}
+			InitConn()
+			results, exitCode := runFiles(os.Stdout, files, hmsArgs, parallel, failFast)
+			if len(results) == 1 {
+				if exitCode != 0 {
+					fmt.Printf("Homescript terminated with exit code: %d \x1b[90m[%.2fs]\x1b[1;0m\n", exitCode, float64(results[0].DurationMs)/1000)
+				} else {
+					fmt.Printf("Homescript was executed successfully: %d \x1b[90m[%.2fs]\x1b[1;0m\n", exitCode, float64(results[0].DurationMs)/1000)
+				}
+			} else {
+				printRunSummary(results)
+			}
+			os.Exit(exitCode)
+		},
+	}
+	addHmsArgFlags(cmdRun)
+	cmdRun.Flags().IntVarP(&parallel, "parallel", "P", 1, "Number of files which are executed concurrently")
+	cmdRun.Flags().BoolVar(&failFast, "fail-fast", false, "Do not start any further files after the first failure")
+	cmdRun.Flags().StringVarP(&output, "output", "o", "table", "Output format of the summary: `table` or `json`")
+	return cmdRun
+}
+
+// Separates files (and glob patterns) from Homescript arguments
+// Tokens naming an existing file are always treated as files, even if they contain a separator
+func splitRunArgs(args []string) (files []string, argTokens []string, err error) {
+	files = make([]string, 0)
+	argTokens = make([]string, 0)
+	for _, arg := range args {
+		if _, statErr := os.Stat(arg); statErr == nil {
+			files = append(files, arg)
+			continue
+		}
+		if strings.ContainsAny(arg, "=:") {
+			argTokens = append(argTokens, arg)
+			continue
+		}
+		matches, err := filepath.Glob(arg)
+		if err != nil {
+			return nil, nil, fmt.Errorf("Invalid glob pattern `%s`: %s", arg, err.Error())
+		}
+		if len(matches) == 0 {
+			return nil, nil, fmt.Errorf("Could not execute Homescript file '%s': no such file", arg)
+		}
+		files = append(files, matches...)
+	}
+	if len(files) == 0 {
+		return nil, nil, fmt.Errorf("No Homescript file specified")
+	}
+	return files, argTokens, nil
+}
+
+// Executes the given files and returns their results in the order of the files
+// The output of the executions is written to `out`
+// The combined exit code is the one of the first failed file (in the order of the files)
+func runFiles(out io.Writer, files []string, args map[string]string, parallel int, failFast bool) ([]runResult, int) {
+	results := make([]runResult, len(files))
+	if parallel > 1 && len(files) > 1 {
+		// Concurrent output would be garbled by spinners and streamed output
+		progress.NonInteractive = true
+		workspace.StreamOutput = false
+		var (
+			wg     sync.WaitGroup
+			lock   sync.Mutex
+			failed bool
+		)
+		slots := make(chan struct{}, parallel)
+		for index, file := range files {
+			slots <- struct{}{}
+			lock.Lock()
+			skip := failed && failFast
+			lock.Unlock()
+			if skip {
+				<-slots
+				results[index] = runResult{File: file, Skipped: true}
+				continue
+			}
+			wg.Add(1)
+			go func(index int, file string) {
+				defer wg.Done()
+				defer func() { <-slots }()
+				results[index] = runFile(out, file, args)
+				if results[index].ExitCode != 0 {
+					lock.Lock()
+					failed = true
+					lock.Unlock()
+				}
+			}(index, file)
+		}
+		wg.Wait()
+	} else {
+		failed := false
+		for index, file := range files {
+			if failed && failFast {
+				results[index] = runResult{File: file, Skipped: true}
+				continue
+			}
+			if len(files) > 1 {
+				fmt.Fprintf(out, "\x1b[1;34m==>\x1b[0m %s\n", file)
+			}
+			results[index] = runFile(out, file, args)
+			failed = failed || results[index].ExitCode != 0
+		}
+	}
+
+	for _, result := range results {
+		if !result.Skipped && result.ExitCode != 0 {
+			return results, result.ExitCode
+		}
+	}
+	return results, 0
+}
+
+// Reads and executes a single Homescript file
+func runFile(out io.Writer, file string, args map[string]string) runResult {
+	startTime := time.Now()
+	content, err := os.ReadFile(file)
+	if err != nil {
+		fmt.Fprintf(out, "Could not execute Homescript file '%s' due to fs error: %s\n", file, err.Error())
+		return runResult{File: file, ExitCode: 1, FirstError: err.Error()}
+	}
+	ctx, cancel := homescriptContext()
+	defer cancel()
+	response, exitCode := workspace.RunCodeWithOutput(ctx, out, Connection, string(content), args, file)
+	result := runResult{
+		File:       file,
+		ExitCode:   exitCode,
+		DurationMs: time.Since(startTime).Milliseconds(),
+		Output:     response.Output,
+	}
+	if len(response.Errors) > 0 {
+		first := response.Errors[0]
+		result.FirstError = fmt.Sprintf("%s at %d:%d: %s", first.ErrorType, first.Location.Line, first.Location.Column, first.Message)
+	}
+	return result
+}
+
+// Prints a table containing the results of all files
+func printRunSummary(results []runResult) {
+	fmt.Println()
+	headerFmt := color.New(color.FgGreen, color.Underline).SprintfFunc()
+	columnFmt := color.New(color.FgYellow).SprintfFunc()
+
+	tbl := table.New("File", "Exit code", "Duration", "First error")
+	tbl.WithHeaderFormatter(headerFmt).WithFirstColumnFormatter(columnFmt)
+	for _, result := range results {
+		if result.Skipped {
+			tbl.AddRow(result.File, "skipped", "-", "-")
+			continue
+		}
+		firstError := result.FirstError
+		if firstError == "" {
+			firstError = "-"
+		}
+		tbl.AddRow(result.File, result.ExitCode, fmt.Sprintf("%.2fs", float64(result.DurationMs)/1000), firstError)
+	}
+	tbl.Print()
+}
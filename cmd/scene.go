@@ -0,0 +1,380 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/pelletier/go-toml"
+	"github.com/rodaine/table"
+	"github.com/spf13/cobra"
+
+	"github.com/smarthome-go/sdk"
+)
+
+// Is appended to the Smarthome-Cli configuration directory, every scene is stored in its own file
+// Scenes can be shared by copying their file into this directory
+const scenesDirName = "scenes"
+
+// Scene names are used as filenames and must therefore not contain any special characters
+var validSceneName = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+// A snapshot of the power states of a set of switches
+type Scene struct {
+	Name      string          `toml:"name"`
+	CreatedAt time.Time       `toml:"created_at"`
+	Switches  map[string]bool `toml:"switches"` // Maps switch IDs to their power state
+}
+
+func createCmdScene() *cobra.Command {
+	cmdScene := &cobra.Command{
+		Use:   "scene",
+		Short: "Power Scenes",
+		Long:  "Save the power states of switches as a scene and restore them later",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := cmd.Help(); err != nil {
+				panic(err.Error())
+			}
+		},
+	}
+
+	var room string
+	cmdSceneSave := &cobra.Command{
+		Use:   "save [name] [switch...]",
+		Short: "Save Scene",
+		Long:  "Captures the current power states of your switches as a scene (optionally only the given switches or the switches of a room)",
+		Args:  cobra.MinimumNArgs(1),
+		PreRun: func(cmd *cobra.Command, args []string) {
+			readConfigFile()
+			InitConn()
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			if !validSceneName.MatchString(args[0]) {
+				fmt.Printf("Invalid scene name `%s`: only letters, digits, `-` and `_` are allowed.\n", args[0])
+				os.Exit(1)
+			}
+			switches := fetchPersonalSwitches()
+			scene := Scene{
+				Name:      args[0],
+				CreatedAt: time.Now(),
+				Switches:  make(map[string]bool),
+			}
+			selected, err := selectSwitches(switches, args[1:], room, room == "")
+			if err != nil {
+				fmt.Printf("Could not save scene: %s\n", err.Error())
+				os.Exit(1)
+			}
+			for _, sw := range selected {
+				scene.Switches[sw.Id] = sw.PowerOn
+			}
+			if err := writeScene(scene); err != nil {
+				fmt.Printf("Could not save scene: %s\n", err.Error())
+				os.Exit(1)
+			}
+			fmt.Printf("Successfully saved scene `%s` containing %d switch(es).\n", scene.Name, len(scene.Switches))
+		},
+	}
+	cmdSceneSave.Flags().StringVar(&room, "room", "", "Only include switches of the given room")
+	if err := cmdSceneSave.RegisterFlagCompletionFunc("room", completeRoomFlag); err != nil {
+		panic(err.Error())
+	}
+
+	cmdSceneApply := &cobra.Command{
+		Use:               "apply [name]",
+		Short:             "Apply Scene",
+		Long:              "Restores the power states of a scene, only switches which differ are changed",
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: completeSceneNames,
+		PreRun: func(cmd *cobra.Command, args []string) {
+			readConfigFile()
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			scene, err := readScene(args[0])
+			if err != nil {
+				fmt.Println(err.Error())
+				os.Exit(1)
+			}
+			InitConn()
+			changes, missing := sceneChanges(scene, fetchPersonalSwitches())
+			// Missing switches are reported separately because they are not failed changes
+			if len(missing) > 0 {
+				fmt.Printf("%d switch(es) not found or not accessible: %s\n", len(missing), strings.Join(missing, ", "))
+			}
+			if len(changes) == 0 {
+				if len(missing) > 0 {
+					fmt.Printf("All other switches of scene `%s` are already in the desired state.\n", scene.Name)
+					os.Exit(1)
+				}
+				fmt.Printf("Scene `%s` is already active.\n", scene.Name)
+				return
+			}
+			failed := printPowerResults(changes, applyPowerChanges(changes))
+			if failed > 0 {
+				fmt.Printf("Scene `%s` was applied partially: %d of %d change(s) failed.\n", scene.Name, failed, len(changes))
+				os.Exit(1)
+			}
+			if len(missing) > 0 {
+				fmt.Printf("Applied scene `%s` except for the missing switch(es).\n", scene.Name)
+				os.Exit(1)
+			}
+			fmt.Printf("Successfully applied scene `%s`.\n", scene.Name)
+		},
+	}
+
+	cmdSceneList := &cobra.Command{
+		Use:   "ls",
+		Short: "List Scenes",
+		Long:  "Lists all saved scenes",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			scenes, err := listScenes()
+			if err != nil {
+				fmt.Printf("Could not list scenes: %s\n", err.Error())
+				os.Exit(1)
+			}
+			if len(scenes) == 0 {
+				fmt.Println("There are no saved scenes, create one using `power scene save`.")
+				return
+			}
+			headerFmt := color.New(color.FgGreen, color.Underline).SprintfFunc()
+			columnFmt := color.New(color.FgYellow).SprintfFunc()
+
+			tbl := table.New("Name", "Switches", "On", "Created")
+			tbl.WithHeaderFormatter(headerFmt).WithFirstColumnFormatter(columnFmt)
+			for _, scene := range scenes {
+				on := 0
+				for _, powerOn := range scene.Switches {
+					if powerOn {
+						on++
+					}
+				}
+				tbl.AddRow(scene.Name, len(scene.Switches), on, scene.CreatedAt.Format("2006-01-02 15:04"))
+			}
+			tbl.Print()
+		},
+	}
+
+	cmdSceneRemove := &cobra.Command{
+		Use:               "rm [name]",
+		Short:             "Remove Scene",
+		Long:              "Deletes a saved scene",
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: completeSceneNames,
+		Run: func(cmd *cobra.Command, args []string) {
+			path, err := scenePath(args[0])
+			if err != nil {
+				fmt.Println(err.Error())
+				os.Exit(1)
+			}
+			if err := os.Remove(path); err != nil {
+				if os.IsNotExist(err) {
+					fmt.Printf("Scene `%s` does not exist.\n", args[0])
+				} else {
+					fmt.Printf("Could not remove scene: %s\n", err.Error())
+				}
+				os.Exit(1)
+			}
+			fmt.Printf("Successfully removed scene `%s`.\n", args[0])
+		},
+	}
+
+	cmdSceneDiff := &cobra.Command{
+		Use:               "diff [name]",
+		Short:             "Compare Scene",
+		Long:              "Shows which switches would be changed by applying a scene",
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: completeSceneNames,
+		PreRun: func(cmd *cobra.Command, args []string) {
+			readConfigFile()
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			scene, err := readScene(args[0])
+			if err != nil {
+				fmt.Println(err.Error())
+				os.Exit(1)
+			}
+			InitConn()
+			changes, missing := sceneChanges(scene, fetchPersonalSwitches())
+			if len(changes) == 0 && len(missing) == 0 {
+				fmt.Printf("Scene `%s` is already active.\n", scene.Name)
+				return
+			}
+			headerFmt := color.New(color.FgGreen, color.Underline).SprintfFunc()
+			columnFmt := color.New(color.FgYellow).SprintfFunc()
+
+			tbl := table.New("ID", "Name", "Current", "Scene")
+			tbl.WithHeaderFormatter(headerFmt).WithFirstColumnFormatter(columnFmt)
+			for _, change := range changes {
+				tbl.AddRow(change.sw.Id, change.sw.Name, powerLabel(change.sw.PowerOn), powerLabel(change.powerOn))
+			}
+			for _, id := range missing {
+				tbl.AddRow(id, "-", color.RedString("missing"), powerLabel(scene.Switches[id]))
+			}
+			tbl.Print()
+		},
+	}
+
+	cmdScene.AddCommand(cmdSceneSave)
+	cmdScene.AddCommand(cmdSceneApply)
+	cmdScene.AddCommand(cmdSceneList)
+	cmdScene.AddCommand(cmdSceneRemove)
+	cmdScene.AddCommand(cmdSceneDiff)
+
+	return cmdScene
+}
+
+// Retrieves the switches of the current user or exits if this fails
+func fetchPersonalSwitches() []sdk.Switch {
+	switches, err := Connection.GetPersonalSwitches()
+	if err != nil {
+		switch err {
+		case sdk.ErrConnFailed:
+			fmt.Println("Failed to fetch switches: network connection to Smarthome was interrupted.")
+		case sdk.ErrServiceUnavailable:
+			fmt.Println("Failed to fetch switches: Smarthome is currently unavailable.")
+		default:
+			fmt.Printf("An unexpected error occurred: %s\n", err.Error())
+		}
+		os.Exit(1)
+	}
+	return switches
+}
+
+// Compares a scene with the current switches
+// Returns the changes which are required in order to apply the scene and the IDs of switches which do not exist anymore
+func sceneChanges(scene Scene, switches []sdk.Switch) ([]powerChange, []string) {
+	changes := make([]powerChange, 0)
+	found := make(map[string]bool, len(scene.Switches))
+	for _, sw := range switches {
+		powerOn, contained := scene.Switches[sw.Id]
+		if !contained {
+			continue
+		}
+		found[sw.Id] = true
+		if sw.PowerOn != powerOn {
+			changes = append(changes, powerChange{sw: sw, powerOn: powerOn})
+		}
+	}
+	missing := make([]string, 0)
+	for id := range scene.Switches {
+		if !found[id] {
+			missing = append(missing, id)
+		}
+	}
+	sort.Strings(missing)
+	return changes, missing
+}
+
+// Returns the directory in which scenes are stored
+func scenesDir() (string, error) {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to determine user config directory: %s", err.Error())
+	}
+	return fmt.Sprintf("%s/%s/%s", configDir, filePathPrefix, scenesDirName), nil
+}
+
+// Returns the path of the file of a scene
+func scenePath(name string) (string, error) {
+	if !validSceneName.MatchString(name) {
+		return "", fmt.Errorf("Invalid scene name `%s`: only letters, digits, `-` and `_` are allowed.", name)
+	}
+	dir, err := scenesDir()
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s/%s.toml", dir, name), nil
+}
+
+func readScene(name string) (Scene, error) {
+	path, err := scenePath(name)
+	if err != nil {
+		return Scene{}, err
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return Scene{}, fmt.Errorf("Scene `%s` does not exist, list scenes using `power scene ls`.", name)
+		}
+		return Scene{}, fmt.Errorf("Could not read scene `%s`: %s", name, err.Error())
+	}
+	var scene Scene
+	if err := toml.Unmarshal(content, &scene); err != nil {
+		return Scene{}, fmt.Errorf("Could not parse scene at `%s`: invalid TOML format: %s", path, err.Error())
+	}
+	// The filename is authoritative so that copied scenes can be renamed
+	scene.Name = name
+	return scene, nil
+}
+
+func writeScene(scene Scene) error {
+	path, err := scenePath(scene.Name)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	marshaled, err := toml.Marshal(scene)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, marshaled, 0644)
+}
+
+// Reads all scenes sorted by name, invalid files are skipped with a warning
+func listScenes() ([]Scene, error) {
+	dir, err := scenesDir()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []Scene{}, nil
+		}
+		return nil, err
+	}
+	scenes := make([]Scene, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".toml") {
+			continue
+		}
+		scene, err := readScene(strings.TrimSuffix(entry.Name(), ".toml"))
+		if err != nil {
+			fmt.Printf("Warning: skipping scene file `%s`: %s\n", entry.Name(), err.Error())
+			continue
+		}
+		scenes = append(scenes, scene)
+	}
+	sort.Slice(scenes, func(i, j int) bool { return scenes[i].Name < scenes[j].Name })
+	return scenes, nil
+}
+
+func completeSceneNames(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	dir, err := scenesDir()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	completions := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		name := strings.TrimSuffix(entry.Name(), ".toml")
+		if strings.HasSuffix(entry.Name(), ".toml") && strings.HasPrefix(name, toComplete) {
+			completions = append(completions, name)
+		}
+	}
+	return completions, cobra.ShellCompDirectiveNoFileComp
+}
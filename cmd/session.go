@@ -0,0 +1,190 @@
+package cmd
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/chzyer/readline"
+
+	"github.com/smarthome-go/sdk"
+)
+
+// Is used if the configuration file does not specify a keepalive interval
+const defaultKeepaliveInterval = 60
+
+// State of an interactive REPL session
+type replSession struct {
+	username string
+	// Is stored because the prompt is also rendered by the keepalive goroutine, which must not access `Connection`
+	hostname string
+	readline *readline.Instance
+	// Is held while the REPL uses the connection, the keepalive probe skips a cycle if it is taken
+	connLock sync.Mutex
+	// Guards the fields below
+	stateLock sync.Mutex
+	connected bool
+	// Exit code and duration of the last execution, displayed in the prompt
+	lastResult string
+	// Results of the keepalive probe which are applied by the REPL goroutine before the next line is handled
+	// The probe must not modify the connection, the switches or the completer itself because readline uses them concurrently
+	probedSwitches []sdk.Switch
+	reconnectDue   bool
+}
+
+// Returns the configured keepalive interval or the default if it is not set
+// A negative interval disables the keepalive
+func keepaliveInterval() time.Duration {
+	if Config.Repl.KeepaliveInterval == 0 {
+		return defaultKeepaliveInterval * time.Second
+	}
+	return time.Duration(Config.Repl.KeepaliveInterval) * time.Second
+}
+
+// Generates the REPL prompt based on the current state
+func (r *replSession) prompt() string {
+	r.stateLock.Lock()
+	defer r.stateLock.Unlock()
+	status := ""
+	if !r.connected {
+		status = " \x1b[1;31m(disconnected)\x1b[0m"
+	}
+	return fmt.Sprintf("\x1b[32m%s\x1b[0m@\x1b[34m%s\x1b[0m%s%s> ",
+		r.username,
+		r.hostname,
+		status,
+		r.lastResult,
+	)
+}
+
+// Applies the current state to the prompt
+func (r *replSession) updatePrompt() {
+	if r.readline == nil {
+		return
+	}
+	r.readline.SetPrompt(r.prompt())
+	r.readline.Refresh()
+}
+
+func (r *replSession) setConnected(connected bool) {
+	r.stateLock.Lock()
+	changed := r.connected != connected
+	r.connected = connected
+	r.stateLock.Unlock()
+	if changed {
+		r.updatePrompt()
+	}
+}
+
+func (r *replSession) isConnected() bool {
+	r.stateLock.Lock()
+	defer r.stateLock.Unlock()
+	return r.connected
+}
+
+func (r *replSession) setLastResult(result string) {
+	r.stateLock.Lock()
+	r.lastResult = result
+	r.stateLock.Unlock()
+	r.updatePrompt()
+}
+
+// Re-authenticates using the stored credentials and updates the connection state
+// The caller must hold `connLock`
+func (r *replSession) reconnect() error {
+	if Verbose {
+		fmt.Printf("Reconnecting.... (using %s@%s)\n",
+			r.username,
+			Connection.SmarthomeURL.Hostname(),
+		)
+	}
+	if err := reconnect(); err != nil {
+		r.setConnected(false)
+		return err
+	}
+	r.setConnected(true)
+	return nil
+}
+
+// Is registered as `workspace.ReconnectHook` while the REPL is running
+func (r *replSession) reconnectHook(err error) (*sdk.Connection, error) {
+	if reconnectErr := r.reconnect(); reconnectErr != nil {
+		fmt.Printf("Connection lost: re-authentication failed: %s\n", reconnectErr.Error())
+		return nil, reconnectErr
+	}
+	if err == sdk.ErrConnFailed {
+		fmt.Println("Connection was re-established, the instruction might not have been executed.")
+	}
+	return Connection, nil
+}
+
+// Checks whether the session is still valid, runs on the keepalive goroutine
+// Fetched switches and a required reconnect are only recorded, `applyProbeResult` applies them
+func (r *replSession) probe() {
+	// Do not interfere with a running execution
+	if !r.connLock.TryLock() {
+		return
+	}
+	switches, err := Connection.GetPersonalSwitches()
+	r.connLock.Unlock()
+	if err == nil {
+		r.stateLock.Lock()
+		r.probedSwitches = switches
+		r.stateLock.Unlock()
+		r.setConnected(true)
+		return
+	}
+	if err != sdk.ErrInvalidCredentials && err != sdk.ErrConnFailed && err != sdk.ErrServiceUnavailable {
+		if Verbose {
+			fmt.Printf("Keepalive probe failed: %s\n", err.Error())
+		}
+		return
+	}
+	r.stateLock.Lock()
+	r.reconnectDue = true
+	r.stateLock.Unlock()
+	r.setConnected(false)
+}
+
+// Applies the results of the last keepalive probe, runs on the REPL goroutine
+// The caller must hold `connLock`
+func (r *replSession) applyProbeResult() {
+	r.stateLock.Lock()
+	switches, reconnectDue := r.probedSwitches, r.reconnectDue
+	r.probedSwitches, r.reconnectDue = nil, false
+	r.stateLock.Unlock()
+	if reconnectDue {
+		if err := r.reconnect(); err != nil && Verbose {
+			fmt.Printf("Keepalive: could not reconnect: %s\n", err.Error())
+		}
+	}
+	if switches != nil {
+		// Update the completions based on the new switches
+		Switches = switches
+		initCompleter()
+	}
+}
+
+// Periodically probes the connection until the returned function is called
+func (r *replSession) startKeepalive() func() {
+	interval := keepaliveInterval()
+	if interval <= 0 {
+		return func() {}
+	}
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				r.probe()
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		ticker.Stop()
+		close(done)
+	}
+}
@@ -2,17 +2,20 @@ package cmd
 
 import (
 	"fmt"
+	"math"
+	"sort"
 	"time"
 
-	"github.com/briandowns/spinner"
 	"github.com/fatih/color"
 	"github.com/rodaine/table"
 
+	"github.com/smarthome-go/cli/cmd/progress"
 	"github.com/smarthome-go/sdk"
 )
 
-func powerStats() {
-	s := spinner.New(spinner.CharSets[11], 150*time.Millisecond)
+// Prints the power states and the draw of all switches matching the filter including totals
+func powerStats(filter switchFilter) {
+	s := progress.New(progress.CharsetDots, 150*time.Millisecond)
 	s.Suffix = " Loading power states"
 	s.Start()
 	switches, err := Connection.GetAllSwitches()
@@ -39,46 +42,111 @@ func powerStats() {
 	tbl.WithHeaderFormatter(headerFmt).WithFirstColumnFormatter(columnFmt)
 
 	// Fill the table
-	var total uint16 = 0
-	var totalOn uint16 = 0
-	var totalNotUsed uint16 = 0
-
-	for _, switchItem := range Switches {
+	var total powerTotals
+	rooms := make(map[string]*powerTotals)
+	roomOrder := make([]string, 0)
+	for _, switchItem := range filter.apply(switches) {
 		var powerIndicator string
 		if switchItem.PowerOn {
 			powerIndicator = "on  *"
-			totalOn += switchItem.Watts
 		} else {
 			powerIndicator = "off ."
-			totalNotUsed += switchItem.Watts
 		}
-		total += switchItem.Watts
+		total.add(switchItem)
+		if _, exists := rooms[switchItem.RoomId]; !exists {
+			rooms[switchItem.RoomId] = &powerTotals{}
+			roomOrder = append(roomOrder, switchItem.RoomId)
+		}
+		rooms[switchItem.RoomId].add(switchItem)
 		tbl.AddRow(switchItem.Id, switchItem.Name, powerIndicator, switchItem.Watts)
 	}
 
-	// Prevent panic
-	if total == 0 {
-		total = 1
-	}
-
 	tbl.AddRow()
-	tbl.AddRow("on ", "total (load)", "on   ", fmt.Sprintf("%-4d ~> %3d%s", totalOn, int((float32(totalOn)/float32(total))*100), `%`))
-	tbl.AddRow("off", "total (free)", "off ", fmt.Sprintf("%-4d ~> %3d%s", totalNotUsed, int((float32(totalNotUsed)/float32(total))*100), `%`))
-	tbl.AddRow("all", "total (all )", "all  ", fmt.Sprintf("%-4d => 100%s", total, `%`))
+	tbl.AddRow("on ", "total (load)", "on   ", fmt.Sprintf("%-6d ~> %3d%s", total.on, percentage(total.on, total.all()), `%`))
+	tbl.AddRow("off", "total (free)", "off ", fmt.Sprintf("%-6d ~> %3d%s", total.off, percentage(total.off, total.all()), `%`))
+	tbl.AddRow("all", "total (all )", "all  ", fmt.Sprintf("%-6d => 100%s", total.all(), `%`))
 	tbl.Print()
+
+	// Per-room subtotals are only useful if there is more than one room
+	if len(roomOrder) > 1 {
+		sort.Strings(roomOrder)
+		fmt.Println()
+		roomTbl := table.New("Room", "Load", "Free", "All", "Load %")
+		roomTbl.WithHeaderFormatter(headerFmt).WithFirstColumnFormatter(columnFmt)
+		for _, room := range roomOrder {
+			subtotal := rooms[room]
+			roomName := room
+			if roomName == "" {
+				roomName = "(no room)"
+			}
+			roomTbl.AddRow(roomName, subtotal.on, subtotal.off, subtotal.all(), fmt.Sprintf("%3d%s", percentage(subtotal.on, subtotal.all()), `%`))
+		}
+		roomTbl.Print()
+	}
+
+	if Config.Power.TariffPrice > 0 {
+		hourly := float64(total.on) / 1000 * Config.Power.TariffPrice
+		fmt.Printf(
+			"\nEstimated cost at the current load: %.2f %s per hour, %.2f %s per day \x1b[90m(%.4f %s/kWh)\x1b[0m\n",
+			hourly,
+			Config.Power.TariffCurrency,
+			hourly*24,
+			Config.Power.TariffCurrency,
+			Config.Power.TariffPrice,
+			Config.Power.TariffCurrency,
+		)
+	}
 }
 
-func listSwitches() {
-	s := spinner.New(spinner.CharSets[11], 150*time.Millisecond)
+// Accumulated power draw of a set of switches
+// Watts are summed up as `int64` because the sum of many `uint16` values would overflow
+type powerTotals struct {
+	on  int64
+	off int64
+}
+
+func (t *powerTotals) add(switchItem sdk.Switch) {
+	if switchItem.PowerOn {
+		t.on += int64(switchItem.Watts)
+	} else {
+		t.off += int64(switchItem.Watts)
+	}
+}
+
+func (t powerTotals) all() int64 {
+	return t.on + t.off
+}
+
+// Returns the rounded percentage of `part` in `total` or zero if `total` is zero
+func percentage(part int64, total int64) int {
+	if total == 0 {
+		return 0
+	}
+	return int(math.Round(float64(part) * 100 / float64(total)))
+}
+
+// Lists the switches of the current user (or all switches) which match the filter
+func listSwitches(filter switchFilter, output string) {
+	s := progress.New(progress.CharsetDots, 150*time.Millisecond)
 	s.Suffix = " Loading switches"
 	s.Start()
-	switches, err := Connection.GetPersonalSwitches()
+	var (
+		switches []sdk.Switch
+		err      error
+	)
+	if filter.all {
+		switches, err = Connection.GetAllSwitches()
+	} else {
+		switches, err = Connection.GetPersonalSwitches()
+	}
 	if err != nil {
 		switch err {
 		case sdk.ErrConnFailed:
 			s.FinalMSG = "Failed to fetch switches: network connection to Smarthome was interrupted.\n"
 		case sdk.ErrServiceUnavailable:
 			s.FinalMSG = "Failed to fetch switches: Smarthome is currently unavailable.\n"
+		case sdk.ErrPermissionDenied:
+			s.FinalMSG = "Failed to fetch switches: you do not have the permission to list all switches.\n"
 		default:
 			s.FinalMSG = fmt.Sprintf("An unexpected error occurred: %s\n", err.Error())
 		}
@@ -87,7 +155,14 @@ func listSwitches() {
 	}
 	s.Stop()
 	// Update switches for autosuggestion
-	Switches = switches
+	if !filter.all {
+		Switches = switches
+	}
+
+	if output == "json" {
+		printJSON(switchesToJSON(filter.apply(switches)))
+		return
+	}
 
 	headerFmt := color.New(color.FgGreen, color.Underline).SprintfFunc()
 	columnFmt := color.New(color.FgYellow).SprintfFunc()
@@ -96,7 +171,7 @@ func listSwitches() {
 	tbl.WithHeaderFormatter(headerFmt).WithFirstColumnFormatter(columnFmt)
 
 	// Fill the table
-	for _, switchItem := range Switches {
+	for _, switchItem := range filter.apply(switches) {
 		powerIndicator := "off"
 		if switchItem.PowerOn {
 			powerIndicator = "on"
@@ -0,0 +1,368 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/smarthome-go/cli/cmd/progress"
+	"github.com/smarthome-go/sdk"
+)
+
+// Prefix of the IDs of one-shot Homescripts created by detached power actions
+// The ID also contains the Unix timestamp at which the Homescript finishes so that it can be removed afterwards
+const detachedScriptPrefix = "cli_timed_"
+
+// How long the CLI waits for the server to reject a detached Homescript before it exits
+const detachedStartGrace = 3 * time.Second
+
+// Performs power changes after a delay (`after`) and / or restores the previous states after a duration (`duration`)
+// In the foreground, a countdown is displayed and Ctrl+C restores the previous states immediately
+// If `detach` is set, delayed changes are performed by a one-shot Homescript on the server
+func runTimedPowerChanges(action string, selected []sdk.Switch, target func(sw sdk.Switch) bool, after time.Duration, duration time.Duration, detach bool) int {
+	if detach {
+		return runDetachedPowerChanges(action, selected, target, after, duration)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if after > 0 {
+		if err := countdown(ctx, after, fmt.Sprintf("Turning %d switch(es) %s", len(selected), action)); err != nil {
+			fmt.Println("Cancelled, no switches were changed.")
+			return 130
+		}
+		// The power states might have changed while waiting
+		selected = refreshSwitches(selected)
+	}
+	exitCode, applied := runPowerChanges(action, powerChanges(selected, target), false)
+	if duration == 0 || len(applied) == 0 {
+		return exitCode
+	}
+
+	interrupted := false
+	if err := countdown(ctx, duration, "Restoring previous state"); err != nil {
+		fmt.Println("Interrupted, restoring previous state now...")
+		interrupted = true
+	}
+	reverts := revertChanges(applied)
+	if failed := printPowerResults(reverts, applyPowerChanges(reverts)); failed > 0 {
+		fmt.Printf("Could not restore %d of %d switch(es).\n", failed, len(reverts))
+		return 1
+	}
+	if interrupted {
+		return 130
+	}
+	return exitCode
+}
+
+// Performs the immediate changes and lets a one-shot Homescript on the server perform the delayed ones
+func runDetachedPowerChanges(action string, selected []sdk.Switch, target func(sw sdk.Switch) bool, after time.Duration, duration time.Duration) int {
+	removeFinishedDetachedScripts()
+	changes := powerChanges(selected, target)
+	exitCode := 0
+	// Every step of the Homescript is a delay followed by changes
+	type step struct {
+		delay   time.Duration
+		changes []powerChange
+	}
+	steps := make([]step, 0, 2)
+	if after > 0 {
+		pending := make([]powerChange, 0, len(changes))
+		for _, change := range changes {
+			if change.sw.PowerOn != change.powerOn {
+				pending = append(pending, change)
+			}
+		}
+		if len(pending) == 0 {
+			fmt.Println("All selected switches are already in the desired state.")
+			return 0
+		}
+		steps = append(steps, step{delay: after, changes: pending})
+		if duration > 0 {
+			steps = append(steps, step{delay: duration, changes: revertChanges(pending)})
+		}
+	} else {
+		var applied []powerChange
+		exitCode, applied = runPowerChanges(action, changes, false)
+		if len(applied) == 0 {
+			return exitCode
+		}
+		steps = append(steps, step{delay: duration, changes: revertChanges(applied)})
+	}
+
+	finishesAt := time.Now().Add(after + duration)
+	var code strings.Builder
+	code.WriteString(fmt.Sprintf("# Created by smarthome-cli (`power %s`), it is removed after it has finished\n", action))
+	for _, step := range steps {
+		code.WriteString(fmt.Sprintf("sleep(%d);\n", int(math.Ceil(step.delay.Seconds()))))
+		for _, change := range step.changes {
+			state := "off"
+			if change.powerOn {
+				state = "on"
+			}
+			code.WriteString(fmt.Sprintf("switch('%s', %s);\n", strings.ReplaceAll(change.sw.Id, "'", "\\'"), state))
+		}
+	}
+	id := fmt.Sprintf("%s%d", detachedScriptPrefix, finishesAt.Unix())
+	if err := startDetachedScript(id, code.String(), after+duration); err != nil {
+		fmt.Printf("Could not detach power action: %s\n", err.Error())
+		return 1
+	}
+	fmt.Printf("The server performs the remaining changes using the Homescript `%s`, which finishes at %s.\n", id, finishesAt.Format("15:04:05"))
+	return exitCode
+}
+
+// Creates a one-shot Homescript and starts it on the server
+// The request is not awaited: the server keeps executing the job after the CLI has exited
+// Only errors which occur before `detachedStartGrace` has passed (such as invalid code or missing permissions) are reported
+func startDetachedScript(id string, code string, runtime time.Duration) error {
+	if res, err := Connection.LintHomescriptCode(code, map[string]string{}, 30*time.Second); err != nil {
+		return err
+	} else if !res.Success {
+		message := res.Message
+		if len(res.Errors) > 0 {
+			message = res.Errors[0].Message
+		}
+		return fmt.Errorf("the generated Homescript is invalid: %s", message)
+	}
+	if err := Connection.CreateHomescript(sdk.HomescriptRequest{
+		Id:          id,
+		Name:        "Timed power action (smarthome-cli)",
+		Description: "One-shot Homescript of a detached power action, it is removed by the CLI after it has finished",
+		Code:        code,
+		MDIcon:      "timer",
+	}); err != nil {
+		switch err {
+		case sdk.ErrPermissionDenied:
+			return errors.New("permission denied: you do not have the permission to create Homescripts")
+		case sdk.ErrUnprocessableEntity:
+			return fmt.Errorf("a Homescript with the ID `%s` already exists", id)
+		}
+		return err
+	}
+	result := make(chan error, 1)
+	go func() {
+		res, err := Connection.RunHomescriptById(id, map[string]string{}, runtime+time.Minute)
+		if err == nil && !res.Success {
+			err = fmt.Errorf("the Homescript failed: %s", res.Message)
+		}
+		result <- err
+	}()
+	select {
+	case err := <-result:
+		// The Homescript has already finished (or failed), therefore it can be removed right away
+		if deleteErr := Connection.DeleteHomescript(id); deleteErr != nil && Verbose {
+			fmt.Printf("Could not remove Homescript `%s`: %s\n", id, deleteErr.Error())
+		}
+		return err
+	case <-time.After(detachedStartGrace):
+		return nil
+	}
+}
+
+// Removes the one-shot Homescripts of detached power actions which have finished
+// Failures are ignored because leftover Homescripts are removed during the next attempt
+func removeFinishedDetachedScripts() {
+	scripts, err := Connection.ListHomescript()
+	if err != nil {
+		return
+	}
+	for _, script := range scripts {
+		if !strings.HasPrefix(script.Data.Id, detachedScriptPrefix) {
+			continue
+		}
+		finishesAt, err := strconv.ParseInt(strings.TrimPrefix(script.Data.Id, detachedScriptPrefix), 10, 64)
+		if err != nil || time.Now().Before(time.Unix(finishesAt, 0).Add(time.Minute)) {
+			continue
+		}
+		if err := Connection.DeleteHomescript(script.Data.Id); err != nil && Verbose {
+			fmt.Printf("Could not remove finished Homescript `%s`: %s\n", script.Data.Id, err.Error())
+		}
+	}
+}
+
+// Returns the change for every switch using the desired power state returned by `target`
+func powerChanges(switches []sdk.Switch, target func(sw sdk.Switch) bool) []powerChange {
+	changes := make([]powerChange, 0, len(switches))
+	for _, sw := range switches {
+		changes = append(changes, powerChange{sw: sw, powerOn: target(sw)})
+	}
+	return changes
+}
+
+// Returns the changes which undo the given (applied) changes
+func revertChanges(changes []powerChange) []powerChange {
+	reverts := make([]powerChange, 0, len(changes))
+	for _, change := range changes {
+		sw := change.sw
+		sw.PowerOn = change.powerOn
+		reverts = append(reverts, powerChange{sw: sw, powerOn: change.sw.PowerOn})
+	}
+	return reverts
+}
+
+// Updates the power states of the given switches
+// If the states cannot be retrieved, the previous states are kept
+func refreshSwitches(switches []sdk.Switch) []sdk.Switch {
+	current, err := Connection.GetPersonalSwitches()
+	if err != nil {
+		fmt.Printf("Warning: could not refresh power states: %s\n", err.Error())
+		return switches
+	}
+	states := make(map[string]bool, len(current))
+	for _, sw := range current {
+		states[sw.Id] = sw.PowerOn
+	}
+	refreshed := make([]sdk.Switch, 0, len(switches))
+	for _, sw := range switches {
+		if powerOn, found := states[sw.Id]; found {
+			sw.PowerOn = powerOn
+		}
+		refreshed = append(refreshed, sw)
+	}
+	return refreshed
+}
+
+// Waits for the given duration while displaying the remaining time
+// Returns the context's error if it is cancelled before the duration has elapsed
+func countdown(ctx context.Context, duration time.Duration, label string) error {
+	deadline := time.Now().Add(duration)
+	if !progress.Enabled() {
+		fmt.Printf("%s in %s\n", label, duration)
+	}
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+	for {
+		if progress.Enabled() {
+			remaining := time.Until(deadline).Round(time.Second)
+			fmt.Printf("\r\x1b[K%s in \x1b[1;33m%s\x1b[0m \x1b[90m(Ctrl+C to abort)\x1b[0m", label, remaining)
+		}
+		select {
+		case <-ticker.C:
+		case <-timer.C:
+			if progress.Enabled() {
+				fmt.Print("\r\x1b[K")
+			}
+			return nil
+		case <-ctx.Done():
+			if progress.Enabled() {
+				fmt.Print("\r\x1b[K")
+			}
+			return ctx.Err()
+		}
+	}
+}
+
+func createCmdPowerWait() *cobra.Command {
+	var (
+		timeout  time.Duration
+		interval time.Duration
+	)
+	cmdPowerWait := &cobra.Command{
+		Use:   "wait [switch-id] [on|off]",
+		Short: "Wait For Switch State",
+		Long:  "Polls the state of a switch until it is turned on or off",
+		Args:  cobra.ExactArgs(2),
+		ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			switch len(args) {
+			case 0:
+				return completeSwitchIds(cmd, args, toComplete)
+			case 1:
+				return []string{"on", "off"}, cobra.ShellCompDirectiveNoFileComp
+			}
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		},
+		PreRun: func(cmd *cobra.Command, args []string) {
+			readConfigFile()
+			InitConn()
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			if args[1] != "on" && args[1] != "off" {
+				fmt.Printf("Invalid state `%s`: expected `on` or `off`.\n", args[1])
+				os.Exit(1)
+			}
+			if interval <= 0 {
+				fmt.Println("The polling interval must be positive.")
+				os.Exit(1)
+			}
+			os.Exit(waitForPower(args[0], args[1] == "on", timeout, interval))
+		},
+	}
+	cmdPowerWait.Flags().DurationVar(&timeout, "timeout", 0, "Give up after the given duration (waits forever by default)")
+	cmdPowerWait.Flags().DurationVar(&interval, "interval", 2*time.Second, "Interval in which the switch state is polled")
+	return cmdPowerWait
+}
+
+// Polls a switch until it reaches the desired power state and returns the exit code
+func waitForPower(id string, powerOn bool, timeout time.Duration, interval time.Duration) int {
+	selected, err := selectSwitches(fetchPersonalSwitches(), []string{id}, "", false)
+	if err != nil {
+		fmt.Println(err.Error())
+		return 1
+	}
+	if len(selected) != 1 {
+		fmt.Printf("`%s` matches %d switches, please specify a single switch.\n", id, len(selected))
+		return 1
+	}
+	sw := selected[0]
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	s := progress.New(progress.CharsetDots, 150*time.Millisecond)
+	s.Suffix = fmt.Sprintf(" Waiting for %s to turn %s", sw.Id, powerLabel(powerOn))
+	s.Start()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if sw.PowerOn == powerOn {
+			s.FinalMSG = fmt.Sprintf("Switch %s is %s.\n", sw.Id, powerLabel(powerOn))
+			s.Stop()
+			return 0
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			s.Stop()
+			if ctx.Err() == context.DeadlineExceeded {
+				fmt.Printf("Timed out: switch %s did not turn %s within %s.\n", sw.Id, powerLabel(powerOn), timeout)
+				return 1
+			}
+			fmt.Println("Cancelled.")
+			return 130
+		}
+		switches, err := Connection.GetPersonalSwitches()
+		if err != nil {
+			// Temporary failures are tolerated, the next poll might succeed
+			if err == sdk.ErrConnFailed || err == sdk.ErrServiceUnavailable {
+				if Verbose {
+					fmt.Printf("\nFailed to poll switch state: %s\n", err.Error())
+				}
+				continue
+			}
+			s.Stop()
+			fmt.Printf("Failed to poll switch state: %s\n", err.Error())
+			return 1
+		}
+		for _, current := range switches {
+			if current.Id == sw.Id {
+				sw = current
+			}
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TLS settings built from the configuration, nil if the defaults are used
+var tlsConfig *tls.Config
+
+// Transport of the CLI's own HTTP requests, it uses the configured TLS settings
+// It is a copy of Go's default transport so that the settings do not leak into other HTTP clients
+var apiTransport = http.DefaultTransport.(*http.Transport).Clone()
+
+// Routes requests to the Smarthome server through `apiTransport` and all other requests through Go's default transport
+// The SDK does not allow configuring its HTTP client and uses `http.DefaultTransport` instead
+// Therefore, the default transport is replaced by this router, which only affects requests to the configured server
+type smarthomeRoundTripper struct {
+	host     string
+	fallback http.RoundTripper
+}
+
+func (t *smarthomeRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Host == t.host {
+		return apiTransport.RoundTrip(req)
+	}
+	return t.fallback.RoundTrip(req)
+}
+
+// Is returned during the TLS handshake if the server's public key matches none of the configured pins
+type tlsPinError struct {
+	actual string
+}
+
+func (e *tlsPinError) Error() string {
+	return fmt.Sprintf("the public key of the server (sha256/%s) does not match any configured pin", e.actual)
+}
+
+// Guards the TLS settings, which are built once per process because the configuration does not change
+var (
+	tlsOnce     sync.Once
+	tlsSetupErr error
+)
+
+// Builds the TLS settings from the configuration and applies them to all connections to the Smarthome server
+// Subsequent calls (for instance while reconnecting) return the result of the first one
+func configureTLS() error {
+	tlsOnce.Do(func() {
+		tlsSetupErr = applyTLSSettings()
+	})
+	return tlsSetupErr
+}
+
+func applyTLSSettings() error {
+	settings := Config.Connection
+	if settings.CaBundle == "" && settings.ClientCert == "" && settings.ClientKey == "" && len(settings.PinSha256) == 0 && !settings.InsecureSkipVerify {
+		return nil
+	}
+	config := &tls.Config{InsecureSkipVerify: settings.InsecureSkipVerify}
+
+	// Certificates of the bundle are trusted in addition to the system's
+	if settings.CaBundle != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		bundle, err := os.ReadFile(settings.CaBundle)
+		if err != nil {
+			return fmt.Errorf("could not read CA bundle: %s", err.Error())
+		}
+		if !pool.AppendCertsFromPEM(bundle) {
+			return fmt.Errorf("CA bundle `%s` does not contain any PEM encoded certificates", settings.CaBundle)
+		}
+		config.RootCAs = pool
+	}
+
+	if settings.ClientCert != "" || settings.ClientKey != "" {
+		if settings.ClientCert == "" || settings.ClientKey == "" {
+			return errors.New("a client certificate requires both `tls_client_cert` and `tls_client_key`")
+		}
+		certificate, err := tls.LoadX509KeyPair(settings.ClientCert, settings.ClientKey)
+		if err != nil {
+			return fmt.Errorf("could not load client certificate: %s", err.Error())
+		}
+		config.Certificates = []tls.Certificate{certificate}
+	}
+
+	// Pins are checked even if certificate verification is disabled, which allows using self-signed certificates safely
+	if len(settings.PinSha256) > 0 {
+		pins := make([]string, 0, len(settings.PinSha256))
+		for _, pin := range settings.PinSha256 {
+			pin = strings.TrimPrefix(strings.TrimSpace(pin), "sha256/")
+			if hash, err := base64.StdEncoding.DecodeString(pin); err != nil || len(hash) != sha256.Size {
+				return fmt.Errorf("invalid pin `%s`: expected the base64 encoded SHA-256 hash of the server's public key", pin)
+			}
+			pins = append(pins, pin)
+		}
+		config.VerifyConnection = func(state tls.ConnectionState) error {
+			if len(state.PeerCertificates) == 0 {
+				return &tlsPinError{actual: "(none)"}
+			}
+			hash := sha256.Sum256(state.PeerCertificates[0].RawSubjectPublicKeyInfo)
+			actual := base64.StdEncoding.EncodeToString(hash[:])
+			for _, pin := range pins {
+				if pin == actual {
+					return nil
+				}
+			}
+			return &tlsPinError{actual: actual}
+		}
+	}
+
+	serverURL, err := url.Parse(Config.Connection.SmarthomeUrl)
+	if err != nil {
+		return fmt.Errorf("invalid Smarthome URL: %s", err.Error())
+	}
+	apiTransport.TLSClientConfig = config
+	apiTransport.CloseIdleConnections()
+	tlsConfig = config
+	// This is the only change to the process-wide transport, see `smarthomeRoundTripper`
+	http.DefaultTransport = &smarthomeRoundTripper{host: serverURL.Host, fallback: http.DefaultTransport}
+	return nil
+}
+
+// Performs a TLS handshake with the configured server using the configured settings
+// Is used to explain connection failures, because the SDK does not report the underlying error
+func checkTLSHandshake(timeout time.Duration) error {
+	serverURL, err := url.Parse(Config.Connection.SmarthomeUrl)
+	if err != nil || serverURL.Scheme != "https" {
+		return nil
+	}
+	port := serverURL.Port()
+	if port == "" {
+		port = "443"
+	}
+	config := &tls.Config{}
+	if tlsConfig != nil {
+		config = tlsConfig.Clone()
+	}
+	config.ServerName = serverURL.Hostname()
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: timeout}, "tcp", net.JoinHostPort(serverURL.Hostname(), port), config)
+	if err != nil {
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			// The server is not reachable at all, this is not a TLS problem
+			return nil
+		}
+		var opErr *net.OpError
+		if errors.As(err, &opErr) && opErr.Op == "dial" {
+			return nil
+		}
+		return err
+	}
+	conn.Close()
+	return nil
+}
+
+// Explains a TLS error and how it can be resolved
+func describeTLSError(err error) string {
+	if explanation, ok := explainTLSError(err); ok {
+		return explanation
+	}
+	return err.Error()
+}
+
+// Returns an explanation of the error including a hint if it was caused by TLS
+func explainTLSError(err error) (string, bool) {
+	var (
+		unknownAuthority x509.UnknownAuthorityError
+		hostnameErr      x509.HostnameError
+		invalidErr       x509.CertificateInvalidError
+		pinErr           *tlsPinError
+		recordErr        tls.RecordHeaderError
+	)
+	switch {
+	case errors.As(err, &unknownAuthority):
+		return "the certificate is signed by an unknown authority.\n=> To trust an internal CA, set `tls_ca_bundle` in the configuration or use `--ca-bundle`", true
+	case errors.As(err, &hostnameErr):
+		return fmt.Sprintf("the certificate is not valid for `%s`: %s\n=> Check the host name of the Smarthome URL", hostnameErr.Host, hostnameErr.Error()), true
+	case errors.As(err, &invalidErr) && invalidErr.Reason == x509.Expired:
+		return fmt.Sprintf("the certificate has expired or is not yet valid: %s\n=> Renew the certificate of the server", invalidErr.Error()), true
+	case errors.As(err, &pinErr):
+		return fmt.Sprintf("%s.\n=> If the server's key was changed on purpose, update `tls_pin_sha256` in the configuration", pinErr.Error()), true
+	case errors.As(err, &recordErr):
+		return "the server does not speak TLS.\n=> Use an `http://` URL or check the port", true
+	case strings.Contains(err.Error(), "certificate required") || strings.Contains(err.Error(), "bad certificate"):
+		return fmt.Sprintf("the server rejected the client certificate: %s\n=> Set a valid client certificate using `tls_client_cert` and `tls_client_key`", err.Error()), true
+	}
+	return "", false
+}
@@ -0,0 +1,135 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/rodaine/table"
+
+	"github.com/smarthome-go/cli/cmd/workspace"
+	"github.com/smarthome-go/sdk"
+)
+
+// A single recorded Homescript execution of a REPL session
+// Transcripts are stored as JSON lines, one entry per executed input
+type TranscriptEntry struct {
+	Time       time.Time             `json:"time"`
+	Input      string                `json:"input"`
+	Output     string                `json:"output"`
+	ExitCode   int                   `json:"exitCode"`
+	Errors     []sdk.HomescriptError `json:"errors"`
+	DurationMs int64                 `json:"durationMs"`
+}
+
+// Appends entries to a transcript file
+type transcriptRecorder struct {
+	file    *os.File
+	encoder *json.Encoder
+}
+
+// Opens (or creates) the transcript file, new entries are appended
+func newTranscriptRecorder(path string) (*transcriptRecorder, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &transcriptRecorder{
+		file:    file,
+		encoder: json.NewEncoder(file),
+	}, nil
+}
+
+// Records a single execution
+func (r *transcriptRecorder) record(input string, output sdk.HomescriptResponse, exitCode int, startTime time.Time) {
+	if err := r.encoder.Encode(TranscriptEntry{
+		Time:       startTime,
+		Input:      input,
+		Output:     output.Output,
+		ExitCode:   exitCode,
+		Errors:     output.Errors,
+		DurationMs: time.Since(startTime).Milliseconds(),
+	}); err != nil {
+		fmt.Printf("Could not record input to transcript: %s\n", err.Error())
+	}
+}
+
+func (r *transcriptRecorder) close() {
+	if err := r.file.Close(); err != nil {
+		fmt.Printf("Could not close transcript file: %s\n", err.Error())
+	}
+}
+
+// Reads all entries of a transcript file
+func readTranscript(path string) ([]TranscriptEntry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	entries := make([]TranscriptEntry, 0)
+	scanner := bufio.NewScanner(file)
+	// Outputs can be a lot longer than the default token size
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var entry TranscriptEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("invalid transcript entry on line %d: %s", lineNumber, err.Error())
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// Re-executes every entry of a transcript and reports differences to the recording
+// Returns the number of entries whose exit code or output differs
+func replayTranscript(path string) int {
+	entries, err := readTranscript(path)
+	if err != nil {
+		fmt.Printf("Could not replay transcript `%s`: %s\n", path, err.Error())
+		os.Exit(1)
+	}
+	headerFmt := color.New(color.FgGreen, color.Underline).SprintfFunc()
+	columnFmt := color.New(color.FgYellow).SprintfFunc()
+
+	tbl := table.New("Entry", "Input", "Exit code", "Output")
+	tbl.WithHeaderFormatter(headerFmt).WithFirstColumnFormatter(columnFmt)
+
+	mismatches := 0
+	for index, entry := range entries {
+		fmt.Printf("\x1b[90m[%d/%d]\x1b[0m %s\n", index+1, len(entries), entry.Input)
+		ctx, cancel := homescriptContext()
+		output, exitCode := workspace.RunCodeWithOutput(ctx, os.Stdout, Connection, entry.Input, make(map[string]string, 0), "replay")
+		cancel()
+		exitCodeStr, outputStr := "same", "same"
+		if exitCode != entry.ExitCode {
+			exitCodeStr = fmt.Sprintf("%d -> %d", entry.ExitCode, exitCode)
+		}
+		if output.Output != entry.Output {
+			outputStr = fmt.Sprintf("%q -> %q", entry.Output, output.Output)
+		}
+		if exitCode != entry.ExitCode || output.Output != entry.Output {
+			mismatches++
+			tbl.AddRow(index+1, entry.Input, exitCodeStr, outputStr)
+		}
+	}
+	fmt.Println()
+	if mismatches == 0 {
+		fmt.Printf("Replayed %d entries: all exit codes and outputs match the recording.\n", len(entries))
+		return 0
+	}
+	fmt.Printf("Replayed %d entries: %d differ from the recording.\n", len(entries), mismatches)
+	tbl.Print()
+	return mismatches
+}
@@ -1,21 +1,163 @@
 package cmd
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
+	"os"
+	"path/filepath"
 	"strings"
+
+	"github.com/pelletier/go-toml"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// File containing Homescript arguments (TOML or JSON)
+	hmsArgsFile string
+	// Environment variables which are passed as Homescript arguments
+	hmsArgsEnv []string
 )
 
+// Registers the flags which are used by `collectHmsArgs`
+func addHmsArgFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&hmsArgsFile, "args-file", "", "Read Homescript arguments from a TOML or JSON file")
+	cmd.Flags().StringArrayVar(&hmsArgsEnv, "arg-env", []string{}, "Pass an environment variable as argument (`KEY` or `key=ENV_VAR`)")
+}
+
+// Collects Homescript arguments from the arguments file, the environment and the command line
+// Later sources override earlier ones: file < environment < command line
+func collectHmsArgs(args []string) (map[string]string, error) {
+	result := make(map[string]string, 0)
+	if hmsArgsFile != "" {
+		fileArgs, err := readHmsArgsFile(hmsArgsFile)
+		if err != nil {
+			return nil, fmt.Errorf("Could not read Homescript arguments from `%s`: %s", hmsArgsFile, err.Error())
+		}
+		for key, value := range fileArgs {
+			result[key] = value
+		}
+	}
+	for _, envArg := range hmsArgsEnv {
+		key, envKey := envArg, envArg
+		if separator := strings.Index(envArg, "="); separator != -1 {
+			key, envKey = envArg[:separator], envArg[separator+1:]
+		}
+		value, exists := os.LookupEnv(envKey)
+		if !exists {
+			return nil, fmt.Errorf("Could not read Homescript argument `%s`: environment variable `%s` is not set", key, envKey)
+		}
+		result[key] = value
+	}
+	cliArgs, err := processHmsArgs(args)
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range cliArgs {
+		result[key] = value
+	}
+	return result, nil
+}
+
+// Parses Homescript arguments in the `key=value` or `key:value` format
+// Only the first separator is used, therefore values may contain `=` or `:` themselves
+// Values starting with `@` are read from a file (`key=@path`) or from stdin (`key=@-`), a literal `@` is escaped as `@@`
 func processHmsArgs(args []string) (map[string]string, error) {
 	argsTemp := make(map[string]string, 0)
 	for indexArg, arg := range args {
-		switch strings.Count(arg, ":") {
-		case 0:
-			return nil, fmt.Errorf("Bad Homescript argument formatting at position %d: '%s' does not contain the ':' separator.\nThe separator is required in order to distinguish between key and value", indexArg, arg)
-		case 1:
-			argsTemp[strings.Split(arg, ":")[0]] = strings.Split(arg, ":")[1]
-		default:
-			return nil, fmt.Errorf("Bad Homescript argument formatting at position %d: '%s' contains more than one ':' separator.\nThe separator is required in order to distinguish between key and value", indexArg, arg)
+		separator := strings.IndexAny(arg, "=:")
+		if separator == -1 {
+			return nil, fmt.Errorf("Bad Homescript argument formatting at position %d: '%s' does not contain a separator ('=' or ':').\nThe separator is required in order to distinguish between key and value", indexArg, arg)
+		}
+		key, value := arg[:separator], arg[separator+1:]
+		if key == "" {
+			return nil, fmt.Errorf("Bad Homescript argument formatting at position %d: '%s' has an empty key", indexArg, arg)
 		}
+		value, err := resolveHmsArgValue(value)
+		if err != nil {
+			return nil, fmt.Errorf("Could not read value of Homescript argument `%s`: %s", key, err.Error())
+		}
+		argsTemp[key] = value
 	}
 	return argsTemp, nil
 }
+
+// Resolves `@path`, `@-` and `@@` values
+func resolveHmsArgValue(value string) (string, error) {
+	switch {
+	case strings.HasPrefix(value, "@@"):
+		return value[1:], nil
+	case value == "@-":
+		content, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSuffix(string(content), "\n"), nil
+	case strings.HasPrefix(value, "@"):
+		content, err := os.ReadFile(value[1:])
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSuffix(string(content), "\n"), nil
+	}
+	return value, nil
+}
+
+// Reads a flat table of arguments from a TOML or JSON file
+// Non-string values are converted to their textual representation
+func readHmsArgsFile(path string) (map[string]string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	raw := make(map[string]interface{})
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		if err := json.Unmarshal(content, &raw); err != nil {
+			return nil, fmt.Errorf("invalid JSON: %s", err.Error())
+		}
+	case ".toml":
+		tree, err := toml.LoadBytes(content)
+		if err != nil {
+			return nil, fmt.Errorf("invalid TOML: %s", err.Error())
+		}
+		raw = tree.ToMap()
+	default:
+		return nil, fmt.Errorf("unsupported file type `%s`: expected `.toml` or `.json`", filepath.Ext(path))
+	}
+	args := make(map[string]string, len(raw))
+	for key, value := range raw {
+		switch typed := value.(type) {
+		case string:
+			args[key] = typed
+		case map[string]interface{}, []interface{}:
+			// Nested values are passed as JSON
+			encoded, err := json.Marshal(typed)
+			if err != nil {
+				return nil, fmt.Errorf("could not encode value of `%s`: %s", key, err.Error())
+			}
+			args[key] = string(encoded)
+		default:
+			args[key] = fmt.Sprint(typed)
+		}
+	}
+	return args, nil
+}
+
+// Exits if the output format is neither `table` nor `json`
+func validateOutputFormat(output string) {
+	if output != "table" && output != "json" {
+		fmt.Printf("Invalid output format `%s`: expected `table` or `json`.\n", output)
+		os.Exit(1)
+	}
+}
+
+// Prints a value as indented JSON
+func printJSON(value interface{}) {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(value); err != nil {
+		fmt.Fprintf(os.Stderr, "Could not encode output: %s\n", err.Error())
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,405 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+
+	"github.com/smarthome-go/sdk"
+)
+
+// How long a switch is highlighted after its power state has changed
+const watchHighlightDuration = 5 * time.Second
+
+// How many load values are kept for the sparkline, it never shows more than a terminal line
+const maxLoadHistory = 512
+
+// Characters used for the sparkline, from low to high
+var sparklineChars = []rune("▁▂▃▄▅▆▇█")
+
+// Keys which are handled by the dashboard
+const (
+	keyUp = iota
+	keyDown
+	keyToggle
+	keyRefresh
+	keyQuit
+)
+
+// State of the `power watch` dashboard
+type powerDashboard struct {
+	// Switches sorted by room and ID
+	switches []sdk.Switch
+	// Maps switch IDs to the time of their last observed state change
+	changed map[string]time.Time
+	// Total load (in watts) of the most recent refreshes, see `maxLoadHistory`
+	loadHistory []int
+	// Index of the selected switch
+	selected int
+	// ID of the selected switch, used to keep the selection across refreshes
+	selectedId string
+	// Message displayed in the status line
+	status     string
+	lastUpdate time.Time
+	interval   time.Duration
+	// Whether refreshes are recorded as local power samples, see `localSampleInterval`
+	record bool
+	// When the last local power sample was recorded and when old samples were last pruned
+	lastSample time.Time
+	lastPrune  time.Time
+	// Whether every switch is shown instead of only the user's personal ones
+	all bool
+}
+
+func createCmdPowerWatch() *cobra.Command {
+	var (
+		interval time.Duration
+		noRecord bool
+		all      bool
+	)
+	cmdPowerWatch := &cobra.Command{
+		Use:   "watch",
+		Short: "Live Power Dashboard",
+		Long:  "A full-screen dashboard of your switches grouped by room which refreshes periodically and allows toggling switches",
+		Args:  cobra.NoArgs,
+		PreRun: func(cmd *cobra.Command, args []string) {
+			readConfigFile()
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			if !term.IsTerminal(int(os.Stdin.Fd())) || !term.IsTerminal(int(os.Stdout.Fd())) {
+				fmt.Println("The power dashboard requires an interactive terminal, use `power draw` instead.")
+				os.Exit(1)
+			}
+			if interval < time.Second {
+				fmt.Println("The refresh interval must be at least one second.")
+				os.Exit(1)
+			}
+			InitConn()
+			if err := watchPower(interval, !noRecord, all); err != nil {
+				fmt.Println(err.Error())
+				os.Exit(1)
+			}
+		},
+	}
+	cmdPowerWatch.Flags().DurationVar(&interval, "interval", 2*time.Second, "Refresh interval of the dashboard")
+	cmdPowerWatch.Flags().BoolVar(&noRecord, "no-record", false, "Do not record samples for `power history`")
+	cmdPowerWatch.Flags().BoolVar(&all, "all", false, "Show all switches instead of only yours (requires permission)")
+	return cmdPowerWatch
+}
+
+// Runs the dashboard until the user quits
+// If `record` is set, refreshes are recorded as local power samples
+// If `all` is set, every switch is shown instead of only the user's personal ones
+func watchPower(interval time.Duration, record bool, all bool) error {
+	oldState, err := term.MakeRaw(int(os.Stdin.Fd()))
+	if err != nil {
+		return fmt.Errorf("Could not initialize terminal: %s", err.Error())
+	}
+	// Use the alternate screen and hide the cursor
+	fmt.Print("\x1b[?1049h\x1b[?25l")
+	defer func() {
+		fmt.Print("\x1b[?25h\x1b[?1049l")
+		if err := term.Restore(int(os.Stdin.Fd()), oldState); err != nil {
+			fmt.Printf("Could not restore terminal: %s\n", err.Error())
+		}
+	}()
+
+	dashboard := powerDashboard{
+		changed:  make(map[string]time.Time),
+		interval: interval,
+		record:   record,
+		all:      all,
+	}
+	keys := readKeys()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	dashboard.refresh()
+	for {
+		dashboard.render()
+		select {
+		case <-ticker.C:
+			dashboard.refresh()
+		case key := <-keys:
+			switch key {
+			case keyQuit:
+				return nil
+			case keyUp:
+				dashboard.moveSelection(-1)
+			case keyDown:
+				dashboard.moveSelection(1)
+			case keyRefresh:
+				dashboard.refresh()
+			case keyToggle:
+				dashboard.toggleSelected()
+				dashboard.refresh()
+			}
+		}
+	}
+}
+
+// Reads keys from stdin (which must be in raw mode) in the background
+func readKeys() <-chan int {
+	keys := make(chan int)
+	go func() {
+		buf := make([]byte, 16)
+		for {
+			n, err := os.Stdin.Read(buf)
+			if err != nil {
+				keys <- keyQuit
+				return
+			}
+			input := string(buf[:n])
+			switch {
+			case input == "\x1b[A" || input == "k":
+				keys <- keyUp
+			case input == "\x1b[B" || input == "j":
+				keys <- keyDown
+			case input == " " || input == "\r" || input == "t":
+				keys <- keyToggle
+			case input == "r":
+				keys <- keyRefresh
+			// Ctrl+C and Ctrl+D are not translated into signals in raw mode
+			case input == "q" || input == "\x1b" || input == "\x03" || input == "\x04":
+				keys <- keyQuit
+			}
+		}
+	}()
+	return keys
+}
+
+// Fetches the current switches and records state changes and the total load
+func (d *powerDashboard) refresh() {
+	var (
+		switches []sdk.Switch
+		err      error
+	)
+	if d.all {
+		switches, err = Connection.GetAllSwitches()
+	} else {
+		switches, err = Connection.GetPersonalSwitches()
+	}
+	if err != nil {
+		switch err {
+		case sdk.ErrConnFailed:
+			d.status = "Failed to refresh: network connection to Smarthome was interrupted"
+		case sdk.ErrServiceUnavailable:
+			d.status = "Failed to refresh: Smarthome is currently unavailable"
+		case sdk.ErrPermissionDenied:
+			d.status = "Failed to refresh: permission denied"
+		default:
+			d.status = fmt.Sprintf("Failed to refresh: %s", err.Error())
+		}
+		return
+	}
+	sort.SliceStable(switches, func(i, j int) bool {
+		if switches[i].RoomId != switches[j].RoomId {
+			return switches[i].RoomId < switches[j].RoomId
+		}
+		return switches[i].Id < switches[j].Id
+	})
+	// Detect state changes, but not during the first refresh
+	stateChanged := false
+	if d.switches != nil {
+		previous := make(map[string]bool, len(d.switches))
+		for _, sw := range d.switches {
+			previous[sw.Id] = sw.PowerOn
+		}
+		for _, sw := range switches {
+			if powerOn, found := previous[sw.Id]; found && powerOn != sw.PowerOn {
+				d.changed[sw.Id] = time.Now()
+				stateChanged = true
+			}
+		}
+	}
+	load := 0
+	for _, sw := range switches {
+		if sw.PowerOn {
+			load += int(sw.Watts)
+		}
+	}
+	// Samples are recorded in a coarse interval (and on state changes) so that the file stays small
+	if d.record && (stateChanged || time.Since(d.lastSample) >= localSampleInterval) {
+		if time.Since(d.lastPrune) >= localSamplePruneInterval {
+			if err := prunePowerSamples(); err != nil {
+				d.status = fmt.Sprintf("Could not prune power samples: %s", err.Error())
+			}
+			d.lastPrune = time.Now()
+		}
+		if err := recordPowerSample(switches); err != nil {
+			d.status = fmt.Sprintf("Could not record power sample: %s", err.Error())
+		}
+		d.lastSample = time.Now()
+	}
+	d.switches = switches
+	d.loadHistory = append(d.loadHistory, load)
+	if len(d.loadHistory) > maxLoadHistory {
+		copy(d.loadHistory, d.loadHistory[len(d.loadHistory)-maxLoadHistory:])
+		d.loadHistory = d.loadHistory[:maxLoadHistory]
+	}
+	d.lastUpdate = time.Now()
+	// Keep the selection on the same switch
+	d.selected = 0
+	for index, sw := range switches {
+		if sw.Id == d.selectedId {
+			d.selected = index
+		}
+	}
+	if len(switches) > 0 {
+		d.selectedId = switches[d.selected].Id
+	}
+}
+
+func (d *powerDashboard) moveSelection(delta int) {
+	if len(d.switches) == 0 {
+		return
+	}
+	d.selected = (d.selected + delta + len(d.switches)) % len(d.switches)
+	d.selectedId = d.switches[d.selected].Id
+}
+
+func (d *powerDashboard) toggleSelected() {
+	if len(d.switches) == 0 {
+		return
+	}
+	sw := d.switches[d.selected]
+	if err := Connection.SetPower(sw.Id, !sw.PowerOn); err != nil {
+		d.status = fmt.Sprintf("Could not toggle %s: %s", sw.Id, describePowerError(err))
+		return
+	}
+	d.status = fmt.Sprintf("Turned %s %s", sw.Id, powerLabel(!sw.PowerOn))
+}
+
+// Draws the entire dashboard
+// As the terminal is in raw mode, lines must be terminated using `\r\n`
+func (d *powerDashboard) render() {
+	width, height, err := term.GetSize(int(os.Stdout.Fd()))
+	if err != nil {
+		width, height = 80, 24
+	}
+	bold := color.New(color.Bold).SprintFunc()
+	room := color.New(color.FgBlue, color.Bold).SprintFunc()
+	gray := color.New(color.FgHiBlack).SprintFunc()
+	on := color.New(color.FgGreen, color.Bold).SprintFunc()
+	highlight := color.New(color.FgBlack, color.BgYellow).SprintFunc()
+	selected := color.New(color.ReverseVideo).SprintFunc()
+
+	header := make([]string, 0)
+	header = append(header, fmt.Sprintf("%s  %s",
+		bold("Power Dashboard"),
+		gray(fmt.Sprintf("%s · updated %s · every %s", Connection.SmarthomeURL.Host, d.lastUpdate.Format("15:04:05"), d.interval)),
+	))
+	load, total := 0, 0
+	for _, sw := range d.switches {
+		total += int(sw.Watts)
+		if sw.PowerOn {
+			load += int(sw.Watts)
+		}
+	}
+	percentage := 0
+	if total > 0 {
+		percentage = load * 100 / total
+	}
+	loadLabel := fmt.Sprintf("Load: %d W of %d W (%d%%) ", load, total, percentage)
+	header = append(header, loadLabel+sparkline(d.loadHistory, width-len(loadLabel)))
+	header = append(header, "")
+
+	// Build all rows, remembering which one is selected so that it can be scrolled into view
+	rows := make([]string, 0)
+	selectedRow := 0
+	currentRoom := ""
+	for index, sw := range d.switches {
+		if index == 0 || sw.RoomId != currentRoom {
+			currentRoom = sw.RoomId
+			roomName := currentRoom
+			if roomName == "" {
+				roomName = "(no room)"
+			}
+			rows = append(rows, room(roomName))
+		}
+		state := gray("off")
+		if sw.PowerOn {
+			state = on("on ")
+		}
+		line := fmt.Sprintf("  %-20s %-28s %s %6d W", truncate(sw.Id, 20), truncate(sw.Name, 28), state, sw.Watts)
+		if changedAt, found := d.changed[sw.Id]; found && time.Since(changedAt) < watchHighlightDuration {
+			line = highlight(line)
+		}
+		if index == d.selected {
+			line = selected(line)
+			selectedRow = len(rows)
+		}
+		rows = append(rows, line)
+	}
+	if len(d.switches) == 0 {
+		rows = append(rows, gray("  There are no switches"))
+	}
+
+	footer := []string{"", gray("↑/↓ or j/k: select · space: toggle · r: refresh · q: quit")}
+	if d.status != "" {
+		footer = append(footer, d.status)
+	}
+
+	// Scroll the rows if they do not fit on the screen
+	available := height - len(header) - len(footer)
+	if available < 1 {
+		available = 1
+	}
+	offset := 0
+	if selectedRow >= available {
+		offset = selectedRow - available + 1
+	}
+	if offset+available > len(rows) {
+		available = len(rows) - offset
+	}
+	visible := rows[offset : offset+available]
+
+	var builder strings.Builder
+	builder.WriteString("\x1b[H\x1b[2J")
+	builder.WriteString(strings.Join(header, "\r\n"))
+	builder.WriteString("\r\n")
+	builder.WriteString(strings.Join(visible, "\r\n"))
+	builder.WriteString("\r\n")
+	builder.WriteString(strings.Join(footer, "\r\n"))
+	fmt.Print(builder.String())
+}
+
+// Renders the most recent values as a sparkline of at most `width` characters
+func sparkline(values []int, width int) string {
+	if width <= 0 || len(values) == 0 {
+		return ""
+	}
+	if len(values) > width {
+		values = values[len(values)-width:]
+	}
+	maximum := 0
+	for _, value := range values {
+		if value > maximum {
+			maximum = value
+		}
+	}
+	var builder strings.Builder
+	for _, value := range values {
+		level := 0
+		if maximum > 0 {
+			level = value * (len(sparklineChars) - 1) / maximum
+		}
+		builder.WriteRune(sparklineChars[level])
+	}
+	return builder.String()
+}
+
+// Shortens text which is longer than `length` characters
+func truncate(text string, length int) string {
+	runes := []rune(text)
+	if len(runes) <= length {
+		return text
+	}
+	return string(runes[:length-1]) + "…"
+}
@@ -0,0 +1,120 @@
+package workspace
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pelletier/go-toml"
+)
+
+// Declares an argument which a project expects, stored as `[[args]]` in `hms.toml`
+type ArgDeclaration struct {
+	Key         string `toml:"key"`
+	Type        string `toml:"type"`    // Either `string`, `number` or `bool`, defaults to `string`
+	Default     string `toml:"default"` // Is used if the argument is not provided
+	Required    bool   `toml:"required"`
+	Description string `toml:"description"`
+}
+
+// Holds the argument declarations of `hms.toml`
+// They are kept separately from `ConfigToml` because they are not synced to the remote
+type argsToml struct {
+	Args []ArgDeclaration `toml:"args"`
+}
+
+// Reads the argument declarations of the project in the current directory
+// Returns an empty list if the project does not declare any arguments
+func ReadArgDeclarations() ([]ArgDeclaration, error) {
+	content, err := os.ReadFile("./hms.toml")
+	if err != nil {
+		return nil, err
+	}
+	return parseArgDeclarations(content)
+}
+
+func parseArgDeclarations(content []byte) ([]ArgDeclaration, error) {
+	var declarations argsToml
+	if err := toml.Unmarshal(content, &declarations); err != nil {
+		return nil, fmt.Errorf("failed to parse argument declarations in `hms.toml`: %s", err.Error())
+	}
+	return declarations.Args, nil
+}
+
+// Encodes argument declarations so that they can be appended to a generated `hms.toml`
+func encodeArgDeclarations(declarations []ArgDeclaration) ([]byte, error) {
+	if len(declarations) == 0 {
+		return []byte{}, nil
+	}
+	encoded, err := toml.Marshal(argsToml{Args: declarations})
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte("\n"), encoded...), nil
+}
+
+// Validates arguments against the project's declarations and inserts defaults for missing ones
+// Returns the complete set of arguments which should be passed to the Homescript
+func ValidateArgs(declarations []ArgDeclaration, args map[string]string) (map[string]string, error) {
+	if len(declarations) == 0 {
+		return args, nil
+	}
+	result := make(map[string]string, len(args))
+	for key, value := range args {
+		result[key] = value
+	}
+	problems := make([]string, 0)
+	declared := make(map[string]bool, len(declarations))
+	for _, declaration := range declarations {
+		declared[declaration.Key] = true
+		value, provided := result[declaration.Key]
+		if !provided {
+			if declaration.Required {
+				problems = append(problems, fmt.Sprintf("missing required argument `%s`%s", declaration.Key, describe(declaration)))
+				continue
+			}
+			if declaration.Default == "" {
+				continue
+			}
+			value = declaration.Default
+			result[declaration.Key] = value
+		}
+		switch declaration.Type {
+		case "", "string":
+		case "number":
+			if _, err := strconv.ParseFloat(value, 64); err != nil {
+				problems = append(problems, fmt.Sprintf("argument `%s` must be a number, got `%s`", declaration.Key, value))
+			}
+		case "bool":
+			if _, err := strconv.ParseBool(value); err != nil {
+				problems = append(problems, fmt.Sprintf("argument `%s` must be a boolean, got `%s`", declaration.Key, value))
+			}
+		default:
+			problems = append(problems, fmt.Sprintf("argument `%s` has an unknown type `%s` in `hms.toml`", declaration.Key, declaration.Type))
+		}
+	}
+	undeclared := make([]string, 0)
+	for key := range result {
+		if !declared[key] {
+			undeclared = append(undeclared, key)
+		}
+	}
+	sort.Strings(undeclared)
+	for _, key := range undeclared {
+		problems = append(problems, fmt.Sprintf("argument `%s` is not declared in `hms.toml`", key))
+	}
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("Invalid Homescript arguments:\n  - %s", strings.Join(problems, "\n  - "))
+	}
+	return result, nil
+}
+
+// Returns the description of a declaration in parentheses or nothing if it has none
+func describe(declaration ArgDeclaration) string {
+	if declaration.Description == "" {
+		return ""
+	}
+	return fmt.Sprintf(" (%s)", declaration.Description)
+}
@@ -0,0 +1,201 @@
+package workspace
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/smarthome-go/sdk"
+)
+
+// Controls how Homescript errors are rendered
+type DiagnosticOptions struct {
+	// How many lines are displayed before and after the affected line(s)
+	ContextLines int
+	// Whether ANSI colors are used
+	Color bool
+	// Width of a tab character, used for expanding tabs and aligning markers
+	TabWidth int
+}
+
+// How many lines are displayed around errors unless configured otherwise
+var DefaultContextLines = 1
+
+// Is used by all functions which print Homescript errors
+var Diagnostics = DiagnosticOptions{
+	ContextLines: DefaultContextLines,
+	Color:        true,
+	TabWidth:     4,
+}
+
+// A problem in a Homescript file which can be rendered with its surrounding code
+// Lines and columns start at 1
+type Diagnostic struct {
+	Kind     string
+	Message  string
+	Filename string
+	Line     int
+	Column   int
+	Notes    []string
+}
+
+// Converts an error returned by the server into a diagnostic
+func diagnosticFromError(err sdk.HomescriptError) Diagnostic {
+	return Diagnostic{
+		Kind:     err.ErrorType,
+		Message:  err.Message,
+		Filename: err.Location.Filename,
+		Line:     int(err.Location.Line),
+		Column:   int(err.Location.Column),
+	}
+}
+
+// Pretty-prints all errors of a Homescript program, grouped by file
+func printErrors(out io.Writer, errors []sdk.HomescriptError, program string, filename string) {
+	if len(errors) == 0 {
+		return
+	}
+	diagnostics := make([]Diagnostic, 0, len(errors))
+	for _, err := range errors {
+		diagnostic := diagnosticFromError(err)
+		diagnostic.Filename = filename
+		diagnostics = append(diagnostics, diagnostic)
+	}
+	fmt.Fprint(out, Diagnostics.Render(diagnostics, program))
+}
+
+// Wraps text in an ANSI escape sequence if colors are enabled
+func (o DiagnosticOptions) paint(style string, text string) string {
+	if !o.Color {
+		return text
+	}
+	return fmt.Sprintf("\x1b[%sm%s\x1b[0m", style, text)
+}
+
+// Replaces tabs with spaces up to the next tab stop
+func (o DiagnosticOptions) expandTabs(line string) string {
+	var builder strings.Builder
+	width := 0
+	for _, char := range line {
+		if char == '\t' {
+			spaces := o.TabWidth - width%o.TabWidth
+			builder.WriteString(strings.Repeat(" ", spaces))
+			width += spaces
+			continue
+		}
+		builder.WriteRune(char)
+		width++
+	}
+	return builder.String()
+}
+
+// Returns the display width of the first `column - 1` characters of a line (tabs are expanded)
+func (o DiagnosticOptions) displayColumn(line string, column int) int {
+	runes := []rune(line)
+	index := column - 1
+	if index < 0 {
+		index = 0
+	}
+	if index > len(runes) {
+		// Columns behind the end of the line are counted as single characters
+		return utf8.RuneCountInString(o.expandTabs(line)) + index - len(runes)
+	}
+	return utf8.RuneCountInString(o.expandTabs(string(runes[:index])))
+}
+
+// Renders a group of diagnostics for the same program
+// Diagnostics are grouped by filename, each group receives a header if there is more than one problem
+func (o DiagnosticOptions) Render(diagnostics []Diagnostic, program string) string {
+	var builder strings.Builder
+	groups := make(map[string][]Diagnostic)
+	order := make([]string, 0)
+	for _, diagnostic := range diagnostics {
+		if _, exists := groups[diagnostic.Filename]; !exists {
+			order = append(order, diagnostic.Filename)
+		}
+		groups[diagnostic.Filename] = append(groups[diagnostic.Filename], diagnostic)
+	}
+	for _, filename := range order {
+		group := groups[filename]
+		if len(group) > 1 {
+			builder.WriteString(o.paint("1", fmt.Sprintf("%d problems in %s:", len(group), filename)))
+			builder.WriteString("\n\n")
+		}
+		for _, diagnostic := range group {
+			builder.WriteString(o.renderOne(diagnostic, program))
+			builder.WriteString("\n")
+		}
+	}
+	return builder.String()
+}
+
+// Renders a single diagnostic including its code context, marker and notes
+func (o DiagnosticOptions) renderOne(d Diagnostic, program string) string {
+	var builder strings.Builder
+	lines := strings.Split(program, "\n")
+
+	builder.WriteString(fmt.Sprintf("%s at %s:%d:%d\n",
+		o.paint("1;36", d.Kind),
+		d.Filename,
+		d.Line,
+		d.Column,
+	))
+
+	// Locations outside of the file cannot be displayed
+	if d.Line < 1 || d.Line > len(lines) {
+		d.Notes = append(d.Notes, fmt.Sprintf("the reported location (line %d) is outside of the file (%d lines)", d.Line, len(lines)))
+		builder.WriteString("\n")
+		builder.WriteString(o.paint("1;31", d.Message))
+		builder.WriteString("\n")
+		o.renderNotes(&builder, d.Notes)
+		return builder.String()
+	}
+
+	contextLines := o.ContextLines
+	if contextLines < 0 {
+		contextLines = 0
+	}
+	firstLine := d.Line - contextLines
+	if firstLine < 1 {
+		firstLine = 1
+	}
+	lastLine := d.Line + contextLines
+	if lastLine > len(lines) {
+		lastLine = len(lines)
+	}
+	gutterWidth := len(fmt.Sprint(lastLine))
+
+	builder.WriteString("\n")
+	for lineNumber := firstLine; lineNumber <= lastLine; lineNumber++ {
+		line := lines[lineNumber-1]
+		builder.WriteString(o.paint("90", fmt.Sprintf(" %*d | ", gutterWidth, lineNumber)))
+		builder.WriteString(o.expandTabs(line))
+		builder.WriteString("\n")
+		if lineNumber != d.Line {
+			continue
+		}
+		// The marker spans the (tab-expanded) width of the character at the reported column
+		markerStart := o.displayColumn(line, d.Column)
+		markerWidth := o.displayColumn(line, d.Column+1) - markerStart
+		if markerWidth < 1 {
+			markerWidth = 1
+		}
+		marker := "^" + strings.Repeat("~", markerWidth-1)
+		builder.WriteString(o.paint("90", fmt.Sprintf(" %*s | ", gutterWidth, "")))
+		builder.WriteString(strings.Repeat(" ", markerStart))
+		builder.WriteString(o.paint("1;31", marker))
+		builder.WriteString("\n")
+	}
+	builder.WriteString("\n")
+	builder.WriteString(o.paint("1;31", d.Message))
+	builder.WriteString("\n")
+	o.renderNotes(&builder, d.Notes)
+	return builder.String()
+}
+
+func (o DiagnosticOptions) renderNotes(builder *strings.Builder, notes []string) {
+	for _, note := range notes {
+		builder.WriteString(fmt.Sprintf("%s %s\n", o.paint("1;34", "= note:"), note))
+	}
+}
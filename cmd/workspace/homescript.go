@@ -1,163 +1,234 @@
 package workspace
 
 import (
+	"context"
 	"fmt"
-	"strings"
+	"io"
+	"os"
 	"time"
 
-	"github.com/briandowns/spinner"
-
+	"github.com/smarthome-go/cli/cmd/progress"
 	"github.com/smarthome-go/sdk"
 )
 
-// Pretty-prints a Homescript error
-func printError(err sdk.HomescriptError, program string) {
-	lines := strings.Split(program, "\n")
-	line1 := ""
-	if err.Location.Line > 1 {
-		line1 = fmt.Sprintf("\n \x1b[90m%- 3d | \x1b[0m%s", err.Location.Line-1, lines[err.Location.Line-2])
-	}
-	line2 := fmt.Sprintf(" \x1b[90m%- 3d | \x1b[0m%s", err.Location.Line, lines[err.Location.Line-1])
-	line3 := ""
-	if int(err.Location.Line) < len(lines) {
-		line3 = fmt.Sprintf("\n \x1b[90m%- 3d | \x1b[0m%s", err.Location.Line+1, lines[err.Location.Line])
-	}
-
-	marker := fmt.Sprintf("%s\x1b[1;31m^\x1b[0m", strings.Repeat(" ", int(err.Location.Column+6)))
-
-	fmt.Printf(
-		"\x1b[1;36m%s\x1b[39m at %s:%d:%d\x1b[0m\n%s\n%s\n%s%s\n\n\x1b[1;31m%s\x1b[0m\n",
-		err.ErrorType,
-		err.Location.Filename,
-		err.Location.Line,
-		err.Location.Column,
-		line1,
-		line2,
-		marker,
-		line3,
-		err.Message,
-	)
+// Is called if a request fails because the session has expired or the connection was lost
+// If it returns a connection, the session was re-established successfully
+// Only requests rejected due to invalid credentials are retried, since others might have been executed already
+var ReconnectHook func(err error) (*sdk.Connection, error)
+
+// Is called if an execution is cancelled or times out in order to stop the Homescript job on the server
+// The id is empty if arbitrary code (instead of a stored Homescript) was executed
+// Executions via the WebSocket endpoint are terminated through the stream and do not use this hook
+var TerminateHook func(id string) error
+
+// Is used as the request timeout if the context passed to an execution function has no deadline
+const DefaultTimeout = time.Minute * 2
+
+// Returns the time left until the context's deadline or `DefaultTimeout` if there is none
+func requestTimeout(ctx context.Context) time.Duration {
+	if deadline, ok := ctx.Deadline(); ok {
+		return time.Until(deadline)
+	}
+	return DefaultTimeout
 }
 
-// Executes an arbitrary Homescript given its id
-// Error handling is done internally and printed directly
-func RunById(connection *sdk.Connection, id string, args map[string]string) int {
-	s := spinner.New([]string{"⠏", "⠛", "⠹", "⢸", "⣰", "⣤", "⣆", "⡇"}, 100*time.Millisecond)
-	s.Prefix = "Executing Homescript "
-	s.FinalMSG = ""
-	start := time.Now()
-	ch := make(chan struct{})
-	go func(ch *chan struct{}) {
-		for {
-			if time.Since(start).Milliseconds() > 200 {
-				s.Start()
-			}
-			select {
-			case <-*ch:
-				s.Stop()
-				return
-			default:
-			}
+// Performs a blocking SDK request in the background and waits until it finishes or the context is done
+// The SDK does not support contexts, therefore the request itself cannot be aborted
+// Instead, its timeout is derived from the context's deadline so that the background goroutine ends at the latest then
+// The channel is buffered so that the goroutine never blocks on sending a result nobody waits for anymore
+// Is only used if the server does not provide the WebSocket endpoint, see `StreamDialer`
+func awaitResponse(ctx context.Context, request func(timeout time.Duration) (sdk.HomescriptResponse, error)) (sdk.HomescriptResponse, error) {
+	type result struct {
+		output sdk.HomescriptResponse
+		err    error
+	}
+	ch := make(chan result, 1)
+	go func() {
+		output, err := request(requestTimeout(ctx))
+		ch <- result{output: output, err: err}
+	}()
+	select {
+	case res := <-ch:
+		return res.output, res.err
+	case <-ctx.Done():
+		return sdk.HomescriptResponse{}, ctx.Err()
+	}
+}
+
+// Performs a request and transparently retries it once if the session has expired
+func awaitResponseWithReconnect(
+	ctx context.Context,
+	connection *sdk.Connection,
+	request func(connection *sdk.Connection, timeout time.Duration) (sdk.HomescriptResponse, error),
+) (sdk.HomescriptResponse, *sdk.Connection, error) {
+	output, err := awaitResponse(ctx, func(timeout time.Duration) (sdk.HomescriptResponse, error) {
+		return request(connection, timeout)
+	})
+	if (err == sdk.ErrInvalidCredentials || err == sdk.ErrConnFailed) && ReconnectHook != nil {
+		newConnection, reconnectErr := ReconnectHook(err)
+		if reconnectErr == nil && err == sdk.ErrInvalidCredentials {
+			connection = newConnection
+			output, err = awaitResponse(ctx, func(timeout time.Duration) (sdk.HomescriptResponse, error) {
+				return request(connection, timeout)
+			})
 		}
-	}(&ch)
-	output, err := connection.RunHomescriptById(id, args, time.Minute*2)
-	ch <- struct{}{}
-	if err != nil {
-		if err == sdk.ErrPermissionDenied {
-			username, err := connection.GetUsername()
-			if err != nil {
-				panic(fmt.Sprintf("Encountered impossible error: %s", err.Error()))
+	}
+	return output, connection, err
+}
+
+// Is passed to `handleRequestError` by streamed executions, which have already asked the server to terminate their job
+func terminatedByStream() error {
+	return nil
+}
+
+// Returns a function which requests termination of a Homescript using `TerminateHook`
+// Is only used if the WebSocket endpoint is unavailable, because the server then terminates every job of the Homescript
+func terminateById(id string) func() error {
+	return func() error {
+		if TerminateHook == nil {
+			return nil
+		}
+		return TerminateHook(id)
+	}
+}
+
+// Prints a failed request and returns a matching exit code
+// If the context was cancelled or has expired, `terminate` is used to stop the job on the server
+// `terminate` is nil if there is no job to stop, for instance while linting
+func handleRequestError(out io.Writer, connection *sdk.Connection, err error, terminate func() error) int {
+	switch err {
+	case context.Canceled, context.DeadlineExceeded:
+		switch {
+		case terminate == nil && err == context.Canceled:
+			fmt.Fprintln(out, "Request was cancelled.")
+		case terminate == nil:
+			fmt.Fprintln(out, "Request timed out.")
+		case err == context.Canceled:
+			fmt.Fprintln(out, "Execution was cancelled, requesting termination...")
+		default:
+			fmt.Fprintln(out, "Execution timed out, requesting termination...")
+		}
+		if terminate != nil {
+			if termErr := terminate(); termErr != nil {
+				fmt.Fprintf(out, "Could not terminate Homescript on the server: %s\n", termErr.Error())
+			} else {
+				fmt.Fprintln(out, "Termination was requested successfully.")
 			}
-			fmt.Printf("Permission denied: you \x1b[90m(%s)\x1b[0m do not have the permission \x1b[90m(homescript)\x1b[0m which is required to use Homescript.\n", username)
-			return 403
 		}
-		fmt.Println(err.Error())
+		if err == context.Canceled {
+			return 130
+		}
 		return 99
+	case sdk.ErrPermissionDenied:
+		username, usernameErr := connection.GetUsername()
+		if usernameErr != nil {
+			panic(fmt.Sprintf("Encountered impossible error: %s", usernameErr.Error()))
+		}
+		fmt.Fprintf(out, "Permission denied: you \x1b[90m(%s)\x1b[0m do not have the permission \x1b[90m(homescript)\x1b[0m which is required to use Homescript.\n", username)
+		return 403
 	}
-	if !output.Success || output.Exitcode != 0 {
-		fmt.Printf("Error: Program terminated abnormally with exit-code %d\n", output.Exitcode)
-		// Retrieve remote code in order to pretty-print the error
-		remoteData, err := connection.GetHomescript(id)
+	fmt.Fprintln(out, err.Error())
+	return 99
+}
+
+// Executes an arbitrary Homescript given its id
+// Error handling is done internally and printed directly
+func RunById(ctx context.Context, connection *sdk.Connection, id string, args map[string]string) int {
+	if output, streamed, err := streamExecution(ctx, os.Stdout, id, "", args); streamed {
 		if err != nil {
-			fmt.Printf("Could not download remote code for error display:\n%s\n", err.Error())
-			return 255
+			return handleRequestError(os.Stdout, connection, err, terminatedByStream)
 		}
-		for _, errorItem := range output.Errors {
-			errorItem.Location.Filename = fmt.Sprintf("%s.hms", id)
-			printError(errorItem, remoteData.Data.Code)
+		if !output.Success || output.Exitcode != 0 {
+			return printRemoteErrors(os.Stdout, connection, id, output)
 		}
 		return output.Exitcode
 	}
+	s := progress.New(progress.CharsetBraille, 100*time.Millisecond)
+	s.Prefix = "Executing Homescript "
+	s.Start()
+	output, connection, err := awaitResponseWithReconnect(ctx, connection, func(connection *sdk.Connection, timeout time.Duration) (sdk.HomescriptResponse, error) {
+		return connection.RunHomescriptById(id, args, timeout)
+	})
+	s.Stop()
+	if err != nil {
+		return handleRequestError(os.Stdout, connection, err, terminateById(id))
+	}
+	if !output.Success || output.Exitcode != 0 {
+		return printRemoteErrors(os.Stdout, connection, id, output)
+	}
 	if output.Output != "" {
 		fmt.Printf("\x1b[90m%s\x1b[0m\n", output.Output)
 	}
 	return output.Exitcode
 }
 
+// Prints the errors of an abnormally terminated Homescript which is stored on the server
+func printRemoteErrors(out io.Writer, connection *sdk.Connection, id string, output sdk.HomescriptResponse) int {
+	fmt.Fprintf(out, "Error: Program terminated abnormally with exit-code %d\n", output.Exitcode)
+	// Retrieve remote code in order to pretty-print the error
+	remoteData, err := connection.GetHomescript(id)
+	if err != nil {
+		fmt.Fprintf(out, "Could not download remote code for error display:\n%s\n", err.Error())
+		return 255
+	}
+	printErrors(out, output.Errors, remoteData.Data.Code, fmt.Sprintf("%s.hms", id))
+	return output.Exitcode
+}
+
 // Executes an arbitrary string of Homescript code
 // Error handling is done internally and printed directly
-func RunCode(connection *sdk.Connection, code string, args map[string]string, filename string) int {
-	s := spinner.New([]string{"⠏", "⠛", "⠹", "⢸", "⣰", "⣤", "⣆", "⡇"}, 100*time.Millisecond)
-	s.Prefix = "Executing Homescript "
-	s.FinalMSG = ""
-	start := time.Now()
-	ch := make(chan struct{})
-	go func(ch *chan struct{}) {
-		for {
-			if time.Since(start).Milliseconds() > 200 {
-				s.Start()
-			}
-			select {
-			case <-*ch:
-				s.Stop()
-				return
-			default:
-			}
-		}
-	}(&ch)
-	output, err := connection.RunHomescriptCode(code, args, time.Minute*2)
-	ch <- struct{}{}
-	if err != nil {
-		username, err := connection.GetUsername()
+func RunCode(ctx context.Context, connection *sdk.Connection, code string, args map[string]string, filename string) int {
+	_, exitCode := RunCodeWithOutput(ctx, os.Stdout, connection, code, args, filename)
+	return exitCode
+}
+
+// Like `RunCode` but also returns the server's response so that callers can inspect the output
+// Everything (output, errors and status messages) is written to `out`
+// If the request itself failed, an empty response is returned
+func RunCodeWithOutput(ctx context.Context, out io.Writer, connection *sdk.Connection, code string, args map[string]string, filename string) (sdk.HomescriptResponse, int) {
+	if output, streamed, err := streamExecution(ctx, out, "", code, args); streamed {
 		if err != nil {
-			panic(fmt.Sprintf("Encountered impossible error: %s", err.Error()))
+			return sdk.HomescriptResponse{}, handleRequestError(out, connection, err, terminatedByStream)
 		}
-		if err == sdk.ErrPermissionDenied {
-			fmt.Printf("Permission denied: you \x1b[90m(%s)\x1b[0m do not have the permission \x1b[90m(homescript)\x1b[0m which is required to use Homescript.\n", username)
-			return 403
+		if !output.Success || output.Exitcode != 0 {
+			printCodeErrors(out, output, code, filename)
 		}
-		fmt.Println(err.Error())
-		return 99
+		return output, output.Exitcode
+	}
+	s := progress.New(progress.CharsetBraille, 100*time.Millisecond)
+	s.Prefix = "Executing Homescript "
+	s.Start()
+	output, connection, err := awaitResponseWithReconnect(ctx, connection, func(connection *sdk.Connection, timeout time.Duration) (sdk.HomescriptResponse, error) {
+		return connection.RunHomescriptCode(code, args, timeout)
+	})
+	s.Stop()
+	if err != nil {
+		return sdk.HomescriptResponse{}, handleRequestError(out, connection, err, terminateById(""))
 	}
 	if !output.Success || output.Exitcode != 0 {
-		fmt.Printf("Error: Program terminated abnormally with exit-code %d\n", output.Exitcode)
-		for _, errorItem := range output.Errors {
-			errorItem.Location.Filename = filename
-			printError(errorItem, code)
-		}
-		return output.Exitcode
+		printCodeErrors(out, output, code, filename)
+		return output, output.Exitcode
 	}
 	if output.Output != "" {
-		fmt.Printf("\x1b[90m%s\x1b[0m\n", output.Output)
+		fmt.Fprintf(out, "\x1b[90m%s\x1b[0m\n", output.Output)
 	}
-	return output.Exitcode
+	return output, output.Exitcode
+}
+
+// Prints the errors of abnormally terminated Homescript code
+func printCodeErrors(out io.Writer, output sdk.HomescriptResponse, code string, filename string) {
+	fmt.Fprintf(out, "Error: Program terminated abnormally with exit-code %d\n", output.Exitcode)
+	printErrors(out, output.Errors, code, filename)
 }
 
 // Lints an arbitrary Homescript given its id
 // Error handling is done internally and printed directly
-func LintById(connection *sdk.Connection, id string, args map[string]string) int {
-	output, err := connection.LintHomescriptById(id, args, time.Minute)
+func LintById(ctx context.Context, connection *sdk.Connection, id string, args map[string]string) int {
+	output, connection, err := awaitResponseWithReconnect(ctx, connection, func(connection *sdk.Connection, timeout time.Duration) (sdk.HomescriptResponse, error) {
+		return connection.LintHomescriptById(id, args, timeout)
+	})
 	if err != nil {
-		username, err := connection.GetUsername()
-		if err != nil {
-			panic(fmt.Sprintf("Encountered impossible error: %s", err.Error()))
-		}
-		if err == sdk.ErrPermissionDenied {
-			fmt.Printf("Permission denied: you \x1b[90m(%s)\x1b[0m do not have the permission \x1b[90m(homescript)\x1b[0m which is required to use Homescript.\n", username)
-			return 403
-		}
-		fmt.Println(err.Error())
-		return 99
+		return handleRequestError(os.Stdout, connection, err, nil)
 	}
 	if !output.Success || output.Exitcode != 0 {
 		fmt.Printf("FAIL: linting discovered problems in '%s.hms':\n", id)
@@ -167,10 +238,7 @@ func LintById(connection *sdk.Connection, id string, args map[string]string) int
 			fmt.Printf("Could not download remote code for error display:\n%s\n", err.Error())
 			return 255
 		}
-		for _, errorItem := range output.Errors {
-			errorItem.Location.Filename = fmt.Sprintf("%s.hms", id)
-			printError(errorItem, remoteData.Data.Code)
-		}
+		printErrors(os.Stdout, output.Errors, remoteData.Data.Code, fmt.Sprintf("%s.hms", id))
 		return output.Exitcode
 	}
 	if output.Output != "" {
@@ -182,26 +250,16 @@ func LintById(connection *sdk.Connection, id string, args map[string]string) int
 
 // Lints an arbitrary string of Homescript code
 // Error handling is done internally and printed directly
-func LintCode(connection *sdk.Connection, code string, args map[string]string, filename string) int {
-	output, err := connection.LintHomescriptCode(code, args, time.Minute*2)
+func LintCode(ctx context.Context, connection *sdk.Connection, code string, args map[string]string, filename string) int {
+	output, connection, err := awaitResponseWithReconnect(ctx, connection, func(connection *sdk.Connection, timeout time.Duration) (sdk.HomescriptResponse, error) {
+		return connection.LintHomescriptCode(code, args, timeout)
+	})
 	if err != nil {
-		username, err := connection.GetUsername()
-		if err != nil {
-			panic(fmt.Sprintf("Encountered impossible error: %s", err.Error()))
-		}
-		if err == sdk.ErrPermissionDenied {
-			fmt.Printf("Permission denied: you \x1b[90m(%s)\x1b[0m do not have the permission \x1b[90m(homescript)\x1b[0m which is required to use Homescript.\n", username)
-			return 403
-		}
-		fmt.Println(err.Error())
-		return 99
+		return handleRequestError(os.Stdout, connection, err, nil)
 	}
 	if !output.Success || output.Exitcode != 0 {
 		fmt.Printf("FAIL: linting discovered problems in '%s':\n", filename)
-		for _, errorItem := range output.Errors {
-			errorItem.Location.Filename = filename
-			printError(errorItem, code)
-		}
+		printErrors(os.Stdout, output.Errors, code, filename)
 		return output.Exitcode
 	}
 	if output.Output != "" {
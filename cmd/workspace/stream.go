@@ -0,0 +1,157 @@
+package workspace
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/smarthome-go/cli/cmd/progress"
+	"github.com/smarthome-go/sdk"
+)
+
+// Opens a WebSocket connection to the server's Homescript run endpoint
+// If it is nil or fails, executions fall back to the request / response API
+// Executions prefer the WebSocket endpoint because only it allows terminating arbitrary code on the server
+var StreamDialer func() (*websocket.Conn, error)
+
+// Whether output received via the WebSocket endpoint is printed immediately
+// Otherwise, it is printed after the execution has finished
+var StreamOutput = true
+
+// Message kinds of the WebSocket Homescript protocol
+const (
+	streamKindInit    = "init"
+	streamKindOutput  = "out"
+	streamKindResults = "res"
+	streamKindKill    = "kill"
+)
+
+type streamArg struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// Is sent by the client in order to start an execution
+// Either `Payload` (the ID of a stored Homescript) or `Code` is set
+type streamInitMessage struct {
+	Kind    string      `json:"kind"`
+	Payload string      `json:"payload,omitempty"`
+	Code    string      `json:"code,omitempty"`
+	Args    []streamArg `json:"args"`
+}
+
+// Is sent by the client in order to terminate the running execution
+type streamKillMessage struct {
+	Kind string `json:"kind"`
+}
+
+// Is sent by the server, either containing output or the final results
+type streamServerMessage struct {
+	Kind     string                `json:"kind"`
+	Payload  string                `json:"payload"`
+	Success  bool                  `json:"success"`
+	Exitcode int                   `json:"exitCode"`
+	Errors   []sdk.HomescriptError `json:"errors"`
+}
+
+// Executes Homescript using the WebSocket endpoint and writes its output to `out` as soon as it arrives (unless `StreamOutput` is false)
+// If the context is done, the server is asked to terminate the job and the connection is closed, which also ends the reader
+// If streaming is not available, `streamed` is false so that the caller can fall back to the regular API
+// The returned response contains the entire output, which has already been printed
+func streamExecution(ctx context.Context, out io.Writer, id string, code string, args map[string]string) (output sdk.HomescriptResponse, streamed bool, err error) {
+	if StreamDialer == nil {
+		return sdk.HomescriptResponse{}, false, nil
+	}
+	conn, err := StreamDialer()
+	if err != nil {
+		// Older servers do not provide the endpoint
+		return sdk.HomescriptResponse{}, false, nil
+	}
+	defer conn.Close()
+
+	initArgs := make([]streamArg, 0)
+	for key, value := range args {
+		initArgs = append(initArgs, streamArg{Key: key, Value: value})
+	}
+	if err := conn.WriteJSON(streamInitMessage{
+		Kind:    streamKindInit,
+		Payload: id,
+		Code:    code,
+		Args:    initArgs,
+	}); err != nil {
+		return sdk.HomescriptResponse{}, false, nil
+	}
+
+	// Read messages in the background so that cancellation can be handled
+	messages := make(chan streamServerMessage)
+	readErr := make(chan error, 1)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			var message streamServerMessage
+			if err := conn.ReadJSON(&message); err != nil {
+				readErr <- err
+				return
+			}
+			select {
+			case messages <- message:
+			case <-done:
+				return
+			}
+			if message.Kind == streamKindResults {
+				return
+			}
+		}
+	}()
+
+	// The spinner is only shown while no output arrives and is paused before anything is printed
+	s := progress.New(progress.CharsetBraille, 100*time.Millisecond)
+	s.Prefix = "Executing Homescript "
+	s.Start()
+	defer s.Stop()
+
+	var outputBuilder strings.Builder
+	for {
+		select {
+		case message := <-messages:
+			switch message.Kind {
+			case streamKindOutput:
+				outputBuilder.WriteString(message.Payload)
+				if StreamOutput {
+					s.Pause()
+					fmt.Fprintf(out, "\x1b[90m%s\x1b[0m", message.Payload)
+					s.Start()
+				}
+			case streamKindResults:
+				s.Stop()
+				if !StreamOutput && outputBuilder.Len() > 0 {
+					fmt.Fprintf(out, "\x1b[90m%s\x1b[0m", outputBuilder.String())
+				}
+				if outputBuilder.Len() > 0 && !strings.HasSuffix(outputBuilder.String(), "\n") {
+					fmt.Fprintln(out)
+				}
+				return sdk.HomescriptResponse{
+					Success:  message.Success,
+					Exitcode: message.Exitcode,
+					Output:   outputBuilder.String(),
+					Errors:   message.Errors,
+				}, true, nil
+			}
+		case err := <-readErr:
+			s.Stop()
+			return sdk.HomescriptResponse{}, true, fmt.Errorf("lost connection to the Homescript stream: %s", err.Error())
+		case <-ctx.Done():
+			s.Stop()
+			if err := conn.WriteJSON(streamKillMessage{Kind: streamKindKill}); err != nil {
+				fmt.Fprintf(out, "Could not request termination: %s\n", err.Error())
+			}
+			// The server has already been asked to terminate the job
+			return sdk.HomescriptResponse{}, true, ctx.Err()
+		}
+	}
+}
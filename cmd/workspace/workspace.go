@@ -1,6 +1,7 @@
 package workspace
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"os"
@@ -137,7 +138,7 @@ func removeProjectFiles(id string) error {
 }
 
 // Reads the local project state and uploads it to the remote
-func PushLocal(c *sdk.Connection, lintOnPush bool) {
+func PushLocal(ctx context.Context, c *sdk.Connection, lintOnPush bool) {
 	if _, err := os.Stat("hms.toml"); err != nil {
 		if os.IsNotExist(err) {
 			fmt.Println("You can only push local state inside a hms-project.")
@@ -177,7 +178,7 @@ func PushLocal(c *sdk.Connection, lintOnPush bool) {
 	// Run optional pre-push lint hook
 	if lintOnPush {
 		fmt.Println("Running pre-push hook: linting local project...")
-		if LintCode(c, string(hmsContent), make(map[string]string), fmt.Sprintf("%s.hms", configToml.Id)) != 0 {
+		if LintCode(ctx, c, string(hmsContent), make(map[string]string), fmt.Sprintf("%s.hms", configToml.Id)) != 0 {
 			fmt.Println("Warning: Pre-push hook failed, continuing push...")
 		}
 
@@ -284,6 +285,18 @@ func PullLocal(c *sdk.Connection) {
 		fmt.Printf("Could not pull remote state: failed to parse server response: %s\n", err.Error())
 		os.Exit(1)
 	}
+	// Argument declarations only exist locally and must be preserved
+	declarations, err := parseArgDeclarations(content)
+	if err != nil {
+		fmt.Printf("Could not pull remote state: %s\n", err.Error())
+		os.Exit(1)
+	}
+	encodedDeclarations, err := encodeArgDeclarations(declarations)
+	if err != nil {
+		fmt.Printf("Could not pull remote state: failed to encode argument declarations: %s\n", err.Error())
+		os.Exit(1)
+	}
+	data = append(data, encodedDeclarations...)
 	if err := os.WriteFile("hms.toml", data, 0775); err != nil {
 		fmt.Printf("Could not pull remote state: failed to update `hms.toml` config file: %s\n", err.Error())
 		os.Exit(1)
@@ -54,7 +54,9 @@ func createCmdWs() *cobra.Command {
 		},
 		Run: func(cmd *cobra.Command, args []string) {
 			InitConn()
-			workspace.PushLocal(Connection, Config.Homescript.LintOnPush)
+			ctx, cancel := homescriptContext()
+			defer cancel()
+			workspace.PushLocal(ctx, Connection, Config.Homescript.LintOnPush)
 		},
 	}
 	cmdWSPush.PersistentFlags().BoolVarP(&overrideConfig.Homescript.LintOnPush, "pushlint", "l", true, "Automatically lint the project before pushing it")
@@ -102,26 +104,26 @@ func createCmdWs() *cobra.Command {
 				os.Exit(1)
 			}
 			// Prepare Homescript arguments
-			hmsArgs := make(map[string]string, 0)
-			if len(args) > 0 {
-				hmsArgsTemp, err := processHmsArgs(args)
-				if err != nil {
-					fmt.Println(err.Error())
-					os.Exit(1)
-				}
-				hmsArgs = hmsArgsTemp
+			hmsArgs, err := projectHmsArgs(args)
+			if err != nil {
+				fmt.Println(err.Error())
+				os.Exit(1)
 			}
 
 			// Init Smarthome connection
 			InitConn()
 
 			// Run the Homescript code
+			ctx, cancel := homescriptContext()
+			defer cancel()
 			var exitCode int
 			if runOnlyLocal {
 				if Verbose {
 					fmt.Printf("Executing `%s.hms` on `%s@%s` using local state...", config.Id, Config.Credentials.Username, Connection.SmarthomeURL.String())
 				}
-				exitCode = workspace.RunCode(Connection,
+				exitCode = workspace.RunCode(
+					ctx,
+					Connection,
 					string(content),
 					hmsArgs,
 					fmt.Sprintf("%s.hms", config.Id),
@@ -131,6 +133,7 @@ func createCmdWs() *cobra.Command {
 					fmt.Printf("Executing `%s.hms` on `%s@%s` using remote state...", config.Id, Config.Credentials.Username, Connection.SmarthomeURL.String())
 				}
 				exitCode = workspace.RunById(
+					ctx,
 					Connection,
 					config.Id,
 					hmsArgs,
@@ -144,6 +147,7 @@ func createCmdWs() *cobra.Command {
 			os.Exit(exitCode)
 		},
 	}
+	addHmsArgFlags(cmdWsRun)
 	cmdWsRun.Flags().BoolVarP(&runOnlyLocal, "local", "l", false, "Whether the file should be executed using the local state or the remote state")
 
 	var lintOnRemote = false
@@ -156,36 +160,35 @@ func createCmdWs() *cobra.Command {
 			readConfigFile()
 		},
 		Run: func(cmd *cobra.Command, args []string) {
-			// Prepare Homescript arguments
-			hmsArgs := make(map[string]string, 0)
-			if len(args) > 0 {
-				hmsArgsTemp, err := processHmsArgs(args)
-				if err != nil {
-					fmt.Println(err.Error())
-					os.Exit(1)
-				}
-				hmsArgs = hmsArgsTemp
-			}
 			// Read the local workspace data
 			content, config, err := workspace.ReadLocalData()
 			if err != nil {
 				fmt.Printf("Error: %s\n", err.Error())
 				os.Exit(1)
 			}
+			// Prepare Homescript arguments
+			hmsArgs, err := projectHmsArgs(args)
+			if err != nil {
+				fmt.Println(err.Error())
+				os.Exit(1)
+			}
 			// Initialize connection to the Smarthome server
 			InitConn()
 			// Lint the Homescript using the data and arguments
+			ctx, cancel := homescriptContext()
+			defer cancel()
 			var exitCode int
 			if lintOnRemote {
 				if Verbose {
 					fmt.Printf("Linting `%s.hms` using remote state...", config.Id)
 				}
-				exitCode = workspace.LintById(Connection, config.Id, hmsArgs)
+				exitCode = workspace.LintById(ctx, Connection, config.Id, hmsArgs)
 			} else {
 				if Verbose {
 					fmt.Printf("Linting `%s.hms` using local state...", config.Id)
 				}
 				exitCode = workspace.LintCode(
+					ctx,
 					Connection,
 					string(content),
 					hmsArgs,
@@ -195,6 +198,7 @@ func createCmdWs() *cobra.Command {
 			os.Exit(exitCode)
 		},
 	}
+	addHmsArgFlags(cmdWsLint)
 	cmdWsLint.Flags().BoolVarP(&lintOnRemote, "remote", "r", false, "Whether the file should be linted using the remote state or the local state")
 
 	var purge bool
@@ -252,3 +256,16 @@ func createCmdWs() *cobra.Command {
 	cmdWS.AddCommand(cmdWSClone)
 	return cmdWS
 }
+
+// Collects the Homescript arguments and validates them against the declarations in `hms.toml`
+func projectHmsArgs(args []string) (map[string]string, error) {
+	hmsArgs, err := collectHmsArgs(args)
+	if err != nil {
+		return nil, err
+	}
+	declarations, err := workspace.ReadArgDeclarations()
+	if err != nil {
+		return nil, fmt.Errorf("Error: %s", err.Error())
+	}
+	return workspace.ValidateArgs(declarations, hmsArgs)
+}
@@ -9,11 +9,13 @@ require (
 	github.com/briandowns/spinner v1.19.0
 	github.com/chzyer/readline v1.5.1
 	github.com/fatih/color v1.13.0
+	github.com/gorilla/websocket v1.5.0
 	github.com/howeyc/gopass v0.0.0-20210920133722-c8aef6fb66ef
 	github.com/pelletier/go-toml v1.9.5
 	github.com/rodaine/table v1.0.1
 	github.com/sergi/go-diff v1.2.0
 	github.com/spf13/cobra v1.5.0
+	golang.org/x/term v0.0.0-20220722155259-a9ba230a4035
 	golang.org/x/text v0.3.7
 )
 
@@ -24,5 +26,4 @@ require (
 	github.com/spf13/pflag v1.0.5 // indirect
 	golang.org/x/crypto v0.0.0-20220817201139-bc19a97f63c8 // indirect
 	golang.org/x/sys v0.0.0-20220818161305-2296e01440c6 // indirect
-	golang.org/x/term v0.0.0-20220722155259-a9ba230a4035 // indirect
 )